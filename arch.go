@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// elfMachines maps the architecture half of an Arch ("arm64" in "arm64_linux") to its ELF machine type
+var elfMachines = map[string]elf.Machine{
+	"amd64":   elf.EM_X86_64,
+	"386":     elf.EM_386,
+	"arm64":   elf.EM_AARCH64,
+	"arm":     elf.EM_ARM,
+	"riscv64": elf.EM_RISCV,
+	"ppc64le": elf.EM_PPC64,
+	"s390x":   elf.EM_S390,
+	"loong64": elf.EM_LOONGARCH,
+}
+
+// hostArch returns the architecture dbin runs on, in the "<arch>_<os>" form used by the repository indexes
+func hostArch() string {
+	return runtime.GOARCH + "_" + runtime.GOOS
+}
+
+// targetArch returns the architecture binaries are installed for, which is the host's unless Arch is set
+func targetArch(config *Config) string {
+	return ternary(config.Arch != "", config.Arch, hostArch())
+}
+
+func isCrossArch(config *Config) bool {
+	return targetArch(config) != hostArch()
+}
+
+func expandRepoURL(config *Config, url string) string {
+	return strings.ReplaceAll(url, "{{arch}}", targetArch(config))
+}
+
+// archTemplateMatches reports whether url is what template becomes once {{arch}} is expanded,
+// whichever architecture it was expanded for
+func archTemplateMatches(template, url string) bool {
+	if !strings.Contains(template, "{{arch}}") {
+		return false
+	}
+	pattern := strings.ReplaceAll(regexp.QuoteMeta(template), regexp.QuoteMeta("{{arch}}"), `[a-z0-9]+_[a-z0-9]+`)
+	matched, _ := regexp.MatchString("^"+pattern+"$", url)
+	return matched
+}
+
+// expandArch replaces {{arch}} with the target architecture in RepoURLs and everywhere a
+// repository URL is used as a key, so that the rest of dbin only ever sees the expanded URLs
+func expandArch(config *Config) error {
+	if config.Arch != "" {
+		parts := strings.Split(config.Arch, "_")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid arch %q, expected <arch>_<os>, such as %s", config.Arch, hostArch())
+		}
+	}
+
+	templated := false
+	for i, url := range config.RepoURLs {
+		templated = templated || strings.Contains(url, "{{arch}}")
+		config.RepoURLs[i] = expandRepoURL(config, url)
+	}
+	if isCrossArch(config) && !templated {
+		fmt.Fprintf(os.Stderr, "Warning: none of the RepoURLs contain {{arch}}, so the indexes for %s are used to install binaries for %s\n", hostArch(), targetArch(config))
+	}
+
+	repos := make(map[string]RepoSettings, len(config.Repos))
+	for url, settings := range config.Repos {
+		mirrors := make([]string, len(settings.Mirrors))
+		for i, mirror := range settings.Mirrors {
+			mirrors[i] = expandRepoURL(config, mirror)
+		}
+		settings.Mirrors = mirrors
+		settings.SigURL = expandRepoURL(config, settings.SigURL)
+		repos[expandRepoURL(config, url)] = settings
+	}
+	config.Repos = repos
+	return nil
+}
+
+// checkBinaryArch refuses ELF files built for a different machine than the target architecture.
+// Anything that is not an ELF file, such as a script, is left alone
+func checkBinaryArch(config *Config, path string) error {
+	machine, known := elfMachines[strings.Split(targetArch(config), "_")[0]]
+	if !known {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	magic := make([]byte, len(elf.ELFMAG))
+	if _, err := file.ReadAt(magic, 0); err != nil || !bytes.Equal(magic, []byte(elf.ELFMAG)) {
+		return nil
+	}
+
+	elfFile, err := elf.NewFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to parse the ELF header of %s: %v", path, err)
+	}
+	if elfFile.Machine != machine {
+		return fmt.Errorf("%s is built for %s, not for %s", path, strings.TrimPrefix(elfFile.Machine.String(), "EM_"), targetArch(config))
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// HostAuth holds the credentials sent to a host, keyed in Config.Auth by the host (and port, if any).
+// Token, Username and Password accept a literal value, "env:VAR" to read it from the environment
+// or "file:/path" to read it from a file
+type HostAuth struct {
+	Token    string `yaml:"Token,omitempty"`
+	Username string `yaml:"Username,omitempty"`
+	Password string `yaml:"Password,omitempty"`
+}
+
+func resolveSecret(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, "env:"):
+		value, ok := os.LookupEnv(strings.TrimPrefix(ref, "env:"))
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", strings.TrimPrefix(ref, "env:"))
+		}
+		return value, nil
+	case strings.HasPrefix(ref, "file:"):
+		data, err := os.ReadFile(strings.TrimPrefix(ref, "file:"))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return ref, nil
+}
+
+// hostCredentials returns the credentials configured for host, falling back to ~/.netrc when UseNetrc is set
+func hostCredentials(config *Config, host string) (HostAuth, bool, error) {
+	if auth, ok := config.Auth[host]; ok {
+		var err error
+		if auth.Token, err = resolveSecret(auth.Token); err != nil {
+			return HostAuth{}, false, fmt.Errorf("failed to read the token for %s: %v", host, err)
+		}
+		if auth.Username, err = resolveSecret(auth.Username); err != nil {
+			return HostAuth{}, false, fmt.Errorf("failed to read the username for %s: %v", host, err)
+		}
+		if auth.Password, err = resolveSecret(auth.Password); err != nil {
+			return HostAuth{}, false, fmt.Errorf("failed to read the password for %s: %v", host, err)
+		}
+		return auth, true, nil
+	}
+
+	if config.UseNetrc {
+		if login, password, ok := netrcCredentials(host); ok {
+			return HostAuth{Username: login, Password: password}, true, nil
+		}
+	}
+	return HostAuth{}, false, nil
+}
+
+// authorizeRequest adds the credentials configured for the host of req, if any
+func authorizeRequest(config *Config, req *http.Request) error {
+	auth, ok, err := hostCredentials(config, req.URL.Host)
+	if err != nil || !ok {
+		return err
+	}
+
+	switch {
+	case auth.Token != "":
+		req.Header.Set("Authorization", "Bearer "+auth.Token)
+	case auth.Username != "" || auth.Password != "":
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+	return nil
+}
+
+func netrcCredentials(host string) (string, string, bool) {
+	netrcPath := os.Getenv("NETRC")
+	if netrcPath == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", false
+		}
+		netrcPath = filepath.Join(homeDir, ".netrc")
+	}
+
+	data, err := os.ReadFile(netrcPath)
+	if err != nil {
+		return "", "", false
+	}
+
+	hostname := strings.Split(host, ":")[0]
+	var login, password string
+	var inMachine, found bool
+	fields := netrcFields(string(data))
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine":
+			if found {
+				return login, password, true
+			}
+			inMachine = i+1 < len(fields) && (fields[i+1] == host || fields[i+1] == hostname)
+			found = inMachine
+			i++
+		case "default":
+			if found {
+				return login, password, true
+			}
+			inMachine, found = true, true
+		case "login", "password":
+			if i+1 < len(fields) && inMachine {
+				if fields[i] == "login" {
+					login = fields[i+1]
+				} else {
+					password = fields[i+1]
+				}
+			}
+			i++
+		}
+	}
+	return login, password, found
+}
+
+// netrcFields splits a .netrc file into its tokens, leaving out the bodies of macdef macros,
+// which run until the next empty line
+func netrcFields(data string) []string {
+	var fields []string
+	inMacro := false
+	for _, line := range strings.Split(data, "\n") {
+		if inMacro {
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		for _, field := range strings.Fields(line) {
+			if field == "macdef" {
+				inMacro = true
+				break
+			}
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// redactURL hides the password of URLs with embedded credentials, so they can be shown in messages
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	return u.Redacted()
+}
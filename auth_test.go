@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNetrcCredentials(t *testing.T) {
+	netrc := `machine first.example.com login first password one
+macdef init
+machine macro.example.com login macro password body
+
+machine second.example.com:8080
+	login second
+	password two
+default login anonymous password guest
+`
+	path := filepath.Join(t.TempDir(), "netrc")
+	if err := os.WriteFile(path, []byte(netrc), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NETRC", path)
+
+	tests := []struct {
+		host, login, password string
+	}{
+		{"first.example.com", "first", "one"},
+		{"second.example.com:8080", "second", "two"},
+		{"macro.example.com", "anonymous", "guest"},
+		{"other.example.com", "anonymous", "guest"},
+	}
+	for _, test := range tests {
+		login, password, ok := netrcCredentials(test.host)
+		if !ok || login != test.login || password != test.password {
+			t.Errorf("netrcCredentials(%q) = %q, %q, %v, want %q, %q", test.host, login, password, ok, test.login, test.password)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v3"
+)
+
+const categoryFilterPrefix = "category:"
+
+func categoriesCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "categories",
+		Usage: "List the categories of the binaries in the repositories, with how many binaries each has",
+		Action: func(ctx context.Context, c *cli.Command) error {
+			config, err := loadConfig(c)
+			if err != nil {
+				return err
+			}
+			uRepoIndex, err := fetchRepoIndex(ctx, config)
+			if err != nil {
+				return err
+			}
+
+			counts := categoryCounts(uRepoIndex)
+			if len(counts) == 0 {
+				return fmt.Errorf("none of the binaries in the repositories are categorized")
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			for _, count := range counts {
+				fmt.Fprintf(w, "%s\t%d\n", count.name, count.count)
+			}
+			return w.Flush()
+		},
+	}
+}
+
+// parseCategories splits the categories of an entry, as the index lists them ("Utility,TextEditor"
+// or "Network; ConsoleOnly"), into a list without repetitions
+func parseCategories(categories string) []string {
+	var parsed []string
+	seen := make(map[string]bool)
+	for _, category := range strings.FieldsFunc(categories, func(r rune) bool { return r == ',' || r == ';' }) {
+		category = strings.TrimSpace(category)
+		if key := strings.ToLower(category); category != "" && !seen[key] {
+			seen[key] = true
+			parsed = append(parsed, category)
+		}
+	}
+	return parsed
+}
+
+// inCategory reports whether one of the categories of the entry at position i contains category,
+// ignoring case, so that "editor" matches both Editor and TextEditor
+func (idx *binaryIndex) inCategory(i int, category string) bool {
+	category = strings.ToLower(category)
+	for _, c := range idx.categories[i] {
+		if strings.Contains(strings.ToLower(c), category) {
+			return true
+		}
+	}
+	return false
+}
+
+type categoryCount struct {
+	name  string
+	count int
+}
+
+// categoryCounts returns how many entries each category has, the largest first. Categories that
+// only differ in case are counted together, under the spelling seen first
+func categoryCounts(uRepoIndex *binaryIndex) []categoryCount {
+	positions := make(map[string]int)
+	var counts []categoryCount
+	for _, categories := range uRepoIndex.categories {
+		for _, category := range categories {
+			key := strings.ToLower(category)
+			if n, ok := positions[key]; ok {
+				counts[n].count++
+				continue
+			}
+			positions[key] = len(counts)
+			counts = append(counts, categoryCount{name: category, count: 1})
+		}
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].count != counts[j].count {
+			return counts[i].count > counts[j].count
+		}
+		return strings.ToLower(counts[i].name) < strings.ToLower(counts[j].name)
+	})
+	return counts
+}
+
+// splitCategoryFilters separates the "category:<c>" filters from the rest of the search terms
+func splitCategoryFilters(searchTerms []string) ([]string, []string) {
+	var terms, categories []string
+	for _, term := range searchTerms {
+		if strings.HasPrefix(strings.ToLower(term), categoryFilterPrefix) {
+			if category := term[len(categoryFilterPrefix):]; category != "" {
+				categories = append(categories, category)
+			}
+			continue
+		}
+		terms = append(terms, term)
+	}
+	return terms, categories
+}
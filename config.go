@@ -1,29 +1,66 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"reflect"
-	"runtime"
 	"strconv"
 	"strings"
 
 	"github.com/goccy/go-yaml"
+	"github.com/urfave/cli/v3"
 )
 
 type Config struct {
-	RepoURLs            []string `yaml:"RepoURLs" env:"DBIN_REPO_URLS"`
-	InstallDir          string   `yaml:"InstallDir" env:"DBIN_INSTALL_DIR XDG_BIN_HOME"`
-	CacheDir            string   `yaml:"CacheDir" env:"DBIN_CACHEDIR"`
-	Limit               uint     `yaml:"SearchResultsLimit"`
-	ProgressbarStyle    int      `yaml:"PbarStyle,omitempty"`
-	DisableTruncation   bool     `yaml:"Truncation" env:"DBIN_NOTRUNCATION"`
-	RetakeOwnership     bool     `yaml:"RetakeOwnership" env:"DBIN_REOWN"`
-	UseIntegrationHooks bool     `yaml:"IntegrationHooks" env:"DBIN_USEHOOKS"`
-	DisableProgressbar  bool     `yaml:"DisablePbar,omitempty" env:"DBIN_NOPBAR"`
-	Hooks               Hooks    `yaml:"Hooks,omitempty"`
+	RepoURLs            []string                `yaml:"RepoURLs" env:"DBIN_REPO_URLS"`
+	Repos               map[string]RepoSettings `yaml:"Repos,omitempty"`
+	AllowUnsignedRepos  bool                    `yaml:"AllowUnsignedRepos" env:"DBIN_ALLOW_UNSIGNED"`
+	RepoPriorities      map[string]int          `yaml:"RepoPriorities,omitempty"`
+	VariantPolicy       VariantPolicy           `yaml:"VariantPolicy"`
+	PinnedVariants      map[string]string       `yaml:"PinnedVariants,omitempty"`
+	Groups              map[string][]string     `yaml:"Groups,omitempty"`
+	Libc                string                  `yaml:"Libc,omitempty" env:"DBIN_LIBC"`
+	VerifyPolicy        string                  `yaml:"VerifyPolicy" env:"DBIN_VERIFY"`
+	DownloadMirrors     map[string][]string     `yaml:"DownloadMirrors,omitempty"`
+	Auth                map[string]HostAuth     `yaml:"Auth,omitempty"`
+	UseNetrc            bool                    `yaml:"UseNetrc" env:"DBIN_USE_NETRC"`
+	Proxy               string                  `yaml:"Proxy,omitempty" env:"DBIN_PROXY"`
+	CABundle            string                  `yaml:"CABundle,omitempty" env:"DBIN_CA_BUNDLE"`
+	ConnectTimeout      int                     `yaml:"ConnectTimeout" env:"DBIN_CONNECT_TIMEOUT"`
+	ReadTimeout         int                     `yaml:"ReadTimeout" env:"DBIN_READ_TIMEOUT"`
+	ParallelDownloads   int                     `yaml:"ParallelDownloads" env:"DBIN_MAX_DOWNLOADS"`
+	MaxDownloadsPerHost int                     `yaml:"MaxDownloadsPerHost" env:"DBIN_MAX_DOWNLOADS_PER_HOST"`
+	DownloadRetries     int                     `yaml:"DownloadRetries" env:"DBIN_RETRIES"`
+	Arch                string                  `yaml:"Arch,omitempty" env:"DBIN_ARCH"`
+	InstallDir          string                  `yaml:"InstallDir" env:"DBIN_INSTALL_DIR XDG_BIN_HOME"`
+	CacheDir            string                  `yaml:"CacheDir" env:"DBIN_CACHEDIR"`
+	StoreDir            string                  `yaml:"StoreDir" env:"DBIN_STORE_DIR"`
+	StoreMaxSize        int                     `yaml:"StoreMaxSize" env:"DBIN_STORE_MAX_SIZE"`
+	DisableStore        bool                    `yaml:"DisableStore,omitempty" env:"DBIN_NOSTORE"`
+	Limit               uint                    `yaml:"SearchResultsLimit"`
+	ProgressbarStyle    int                     `yaml:"PbarStyle,omitempty"`
+	DisableTruncation   bool                    `yaml:"Truncation" env:"DBIN_NOTRUNCATION"`
+	RetakeOwnership     bool                    `yaml:"RetakeOwnership" env:"DBIN_REOWN"`
+	UseIntegrationHooks bool                    `yaml:"IntegrationHooks" env:"DBIN_USEHOOKS"`
+	DisableProgressbar  bool                    `yaml:"DisablePbar,omitempty" env:"DBIN_NOPBAR"`
+	IndexCacheMaxAge    int                     `yaml:"IndexCacheMaxAge" env:"DBIN_INDEX_MAXAGE"`
+	RefreshIndex        bool                    `yaml:"-"`
+	Offline             bool                    `yaml:"Offline,omitempty" env:"DBIN_OFFLINE"`
+	RepoFetchTimeout    int                     `yaml:"RepoFetchTimeout" env:"DBIN_REPO_TIMEOUT"`
+	RequireAllRepos     bool                    `yaml:"RequireAllRepos" env:"DBIN_REQUIRE_ALL_REPOS"`
+	Hooks               Hooks                   `yaml:"Hooks,omitempty"`
+}
+
+// RepoSettings holds the per-repository options, keyed in Config.Repos by the URL as it appears in RepoURLs
+type RepoSettings struct {
+	Disabled      bool     `yaml:"Disabled,omitempty"`
+	Mirrors       []string `yaml:"Mirrors,omitempty"`
+	PubKeys       []string `yaml:"PubKeys,omitempty"`
+	SigURL        string   `yaml:"SigURL,omitempty"`
+	AllowUnsigned bool     `yaml:"AllowUnsigned,omitempty"`
 }
 
 type Hooks struct {
@@ -39,7 +76,7 @@ type HookCommands struct {
 	NoOp                  bool     `yaml:"nop"`
 }
 
-func executeHookCommand(config *Config, cmdTemplate, bEntryPath, extension string, isIntegration bool, verbosityLevel Verbosity, uRepoIndex []binaryEntry) error {
+func executeHookCommand(config *Config, cmdTemplate, bEntryPath, extension string, isIntegration bool, verbosityLevel Verbosity, uRepoIndex *binaryIndex) error {
 	hookCommands, exists := config.Hooks.Commands[extension]
 	if !exists {
 		return fmt.Errorf("no commands found for extension: %s", extension)
@@ -59,7 +96,7 @@ func executeHookCommand(config *Config, cmdTemplate, bEntryPath, extension strin
 	args := commandParts[1:]
 
 	if hookCommands.UseRunFromCache {
-		return runFromCache(config, stringToBinaryEntry(command), args, true, verbosityLevel)
+		return runFromCache(context.Background(), config, stringToBinaryEntry(command), args, true, verbosityLevel)
 	}
 
 	cmdExec := exec.Command(command, args...)
@@ -77,18 +114,14 @@ func executeHookCommand(config *Config, cmdTemplate, bEntryPath, extension strin
 	return nil
 }
 
-func loadConfig() (*Config, error) {
+func loadConfig(c *cli.Command) (*Config, error) {
 	cfg := Config{}
 	setDefaultValues(&cfg)
 
 	if noConfig, _ := strconv.ParseBool(os.Getenv("DBIN_NOCONFIG")); !noConfig {
-		configFilePath := os.Getenv("DBIN_CONFIG_FILE")
-		if configFilePath == "" {
-			userConfigDir, err := os.UserConfigDir()
-			if err != nil {
-				return nil, fmt.Errorf("failed to get user config directory: %v", err)
-			}
-			configFilePath = filepath.Join(userConfigDir, "dbin.yaml")
+		configFilePath, err := getConfigFilePath()
+		if err != nil {
+			return nil, err
 		}
 		if _, err := os.Stat(configFilePath); os.IsNotExist(err) {
 			if err := createDefaultConfig(); err != nil {
@@ -101,9 +134,99 @@ func loadConfig() (*Config, error) {
 	}
 
 	overrideWithEnv(&cfg)
+	overrideWithFlags(c, &cfg)
+	if err := checkVerifyPolicy(&cfg); err != nil {
+		return nil, err
+	}
+	if err := expandArch(&cfg); err != nil {
+		return nil, err
+	}
 	return &cfg, nil
 }
 
+func getConfigFilePath() (string, error) {
+	if configFilePath := os.Getenv("DBIN_CONFIG_FILE"); configFilePath != "" {
+		return configFilePath, nil
+	}
+	userConfigDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user config directory: %v", err)
+	}
+	return filepath.Join(userConfigDir, "dbin.yaml"), nil
+}
+
+// editConfigFile applies edit to the settings as written in the config file, not as overridden by
+// the environment or the flags, and writes back the top-level keys given, leaving every other key
+// and comment of the file in place. It returns the path of the config file
+func editConfigFile(edit func(cfg *Config) error, keys ...string) (string, error) {
+	if noConfig, _ := strconv.ParseBool(os.Getenv("DBIN_NOCONFIG")); noConfig {
+		return "", fmt.Errorf("cannot edit the config file while DBIN_NOCONFIG is set")
+	}
+	configFilePath, err := getConfigFilePath()
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(configFilePath); os.IsNotExist(err) {
+		if err := createDefaultConfig(); err != nil {
+			return "", fmt.Errorf("failed to create default config file: %v", err)
+		}
+	}
+
+	cfg := Config{}
+	setDefaultValues(&cfg)
+	if err := loadYAML(configFilePath, &cfg); err != nil {
+		return "", fmt.Errorf("failed to load YAML file: %v", err)
+	}
+	if err := edit(&cfg); err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(configFilePath)
+	if err != nil {
+		return "", err
+	}
+	var doc yaml.MapSlice
+	comments := yaml.CommentMap{}
+	if err := yaml.UnmarshalWithOptions(data, &doc, yaml.UseOrderedMap(), yaml.CommentToMap(comments)); err != nil {
+		return "", fmt.Errorf("failed to parse %s: %v", configFilePath, err)
+	}
+
+	v := reflect.ValueOf(cfg)
+	for _, key := range keys {
+		var value interface{}
+		for i := 0; i < v.NumField(); i++ {
+			if strings.Split(v.Type().Field(i).Tag.Get("yaml"), ",")[0] == key {
+				value = v.Field(i).Interface()
+			}
+		}
+		doc = setMapSliceKey(doc, key, value)
+	}
+
+	out, err := yaml.MarshalWithOptions(doc, yaml.WithComment(comments))
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal config to YAML: %v", err)
+	}
+	tempFile := configFilePath + ".tmp"
+	if err := os.WriteFile(tempFile, out, 0644); err != nil {
+		return "", fmt.Errorf("failed to write config file: %v", err)
+	}
+	if err := os.Rename(tempFile, configFilePath); err != nil {
+		_ = os.Remove(tempFile)
+		return "", fmt.Errorf("failed to write config file: %v", err)
+	}
+	return configFilePath, nil
+}
+
+func setMapSliceKey(doc yaml.MapSlice, key string, value interface{}) yaml.MapSlice {
+	for i := range doc {
+		if k, ok := doc[i].Key.(string); ok && k == key {
+			doc[i].Value = value
+			return doc
+		}
+	}
+	return append(doc, yaml.MapItem{Key: key, Value: value})
+}
+
 func loadYAML(filePath string, cfg *Config) error {
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -156,6 +279,24 @@ func overrideWithEnv(cfg *Config) {
 	}
 }
 
+func overrideWithFlags(c *cli.Command, cfg *Config) {
+	if c.Bool("refresh") {
+		cfg.RefreshIndex = true
+	}
+	if c.Bool("offline") {
+		cfg.Offline = true
+	}
+	if c.Bool("require-all-repos") {
+		cfg.RequireAllRepos = true
+	}
+	if arch := c.String("arch"); arch != "" {
+		cfg.Arch = arch
+	}
+	if installDir := c.String("install-dir"); installDir != "" {
+		cfg.InstallDir = installDir
+	}
+}
+
 func setDefaultValues(config *Config) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
@@ -163,15 +304,26 @@ func setDefaultValues(config *Config) {
 		return
 	}
 	config.InstallDir = filepath.Join(homeDir, ".local/bin")
+	dataDir := os.Getenv("XDG_DATA_HOME")
+	if dataDir == "" {
+		dataDir = filepath.Join(homeDir, ".local/share")
+	}
+	// StoreMaxSize also bounds the extra space the store takes where the filesystem has no
+	// reflinks (e.g ext4): installed binaries are copies of the ones in it, so it doubles what
+	// they take there. DisableStore turns it off
+	config.StoreDir = filepath.Join(dataDir, "dbin", "store")
+	config.StoreMaxSize = 2048
 	tempDir, err := os.UserCacheDir()
 	if err != nil {
 		fmt.Printf("failed to get user's Cache directory: %v\n", err)
 		return
 	}
 	config.CacheDir = filepath.Join(tempDir, "dbin_cache")
-	arch := runtime.GOARCH + "_" + runtime.GOOS
 	config.RepoURLs = []string{
-		"https://github.com/xplshn/dbin-metadata/raw/refs/heads/master/misc/cmd/modMetadata/METADATA_" + arch + ".lite.cbor.zst",
+		"https://github.com/xplshn/dbin-metadata/raw/refs/heads/master/misc/cmd/modMetadata/METADATA_{{arch}}.lite.cbor.zst",
+	}
+	config.Repos = map[string]RepoSettings{
+		config.RepoURLs[0]: {AllowUnsigned: true},
 	}
 	config.DisableTruncation = false
 	config.Limit = 90
@@ -179,6 +331,15 @@ func setDefaultValues(config *Config) {
 	config.RetakeOwnership = false
 	config.ProgressbarStyle = 1
 	config.DisableProgressbar = false
+	config.IndexCacheMaxAge = 3600
+	config.RepoFetchTimeout = 30
+	config.ConnectTimeout = 10
+	config.VariantPolicy = VariantPolicy{Avoid: []string{"glibc"}}
+	config.ReadTimeout = 30
+	config.VerifyPolicy = verifyStrict
+	config.ParallelDownloads = 8
+	config.MaxDownloadsPerHost = 4
+	config.DownloadRetries = 3
 }
 
 func createDefaultConfig() error {
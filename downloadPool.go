@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hedzr/progressbar"
+)
+
+const (
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 30 * time.Second
+)
+
+// downloadSlots bounds how many downloads run at once, in total and against each host, so that
+// installing many binaries does not open a connection for every one of them
+type downloadSlots struct {
+	all     chan struct{}
+	perHost int
+	mu      sync.Mutex
+	hosts   map[string]chan struct{}
+}
+
+var (
+	slots     *downloadSlots
+	slotsOnce sync.Once
+)
+
+func loadDownloadSlots(config *Config) *downloadSlots {
+	slotsOnce.Do(func() {
+		slots = &downloadSlots{
+			all:     make(chan struct{}, max(config.ParallelDownloads, 1)),
+			perHost: max(config.MaxDownloadsPerHost, 1),
+			hosts:   make(map[string]chan struct{}),
+		}
+	})
+	return slots
+}
+
+// acquire waits for a free slot for host, and then for a free slot overall. The host slot is
+// taken first so that downloads queued behind a busy host do not keep others from running
+func (s *downloadSlots) acquire(ctx context.Context, host string) (func(), error) {
+	s.mu.Lock()
+	hostSlots, ok := s.hosts[host]
+	if !ok {
+		hostSlots = make(chan struct{}, s.perHost)
+		s.hosts[host] = hostSlots
+	}
+	s.mu.Unlock()
+
+	select {
+	case hostSlots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case s.all <- struct{}{}:
+	case <-ctx.Done():
+		<-hostSlots
+		return nil, ctx.Err()
+	}
+	return func() {
+		<-s.all
+		<-hostSlots
+	}, nil
+}
+
+// downloadHost returns the host a download URL or OCI reference is fetched from
+func downloadHost(url string) string {
+	if ref, ok := strings.CutPrefix(url, "oci://"); ok {
+		host, _, _ := strings.Cut(ref, "/")
+		return host
+	}
+	return mirrorHost(url)
+}
+
+// httpStatusError is a response that did not carry the file
+type httpStatusError struct {
+	url        string
+	status     string
+	statusCode int
+	retryAfter time.Duration
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("error fetching from %s: unexpected status %s", redactURL(e.url), e.status)
+}
+
+func newHTTPStatusError(resp *http.Response, url string) error {
+	return &httpStatusError{url: url, status: resp.Status, statusCode: resp.StatusCode, retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+}
+
+// parseRetryAfter reads a Retry-After header, given either in seconds or as a date
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
+
+// isTransient reports whether err may go away by trying again: the connection being refused,
+// reset, timing out or cut short, the server failing (5xx) or asking to slow down (429). Other
+// network errors, such as bad certificates or unknown hosts, will not go away on their own
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.statusCode == http.StatusTooManyRequests || statusErr.statusCode >= 500
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// retryDelay returns how long to wait before the given retry (counting from 1): exponential
+// backoff with jitter, unless the server said when to come back. Either way it is capped at retryMaxDelay
+func retryDelay(err error, retry int) time.Duration {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) && statusErr.retryAfter > 0 {
+		return min(statusErr.retryAfter, retryMaxDelay)
+	}
+	delay := min(retryBaseDelay<<(retry-1), retryMaxDelay)
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// isRangeNotSatisfiable reports whether err is the server refusing to resume a download, which
+// checkDownloadStatus answers by discarding the partial download
+func isRangeNotSatisfiable(err error) bool {
+	var statusErr *httpStatusError
+	return errors.As(err, &statusErr) && statusErr.statusCode == http.StatusRequestedRangeNotSatisfiable
+}
+
+// withRetries runs fetch, in a download slot of url's host, until it succeeds, fails with an error
+// that is not transient, or DownloadRetries retries have been made. A download the server refused
+// to resume is started over once, right away. What it is waiting for is shown next to the title of bar
+func withRetries(ctx context.Context, config *Config, bar progressbar.PB, url string, fetch func() error) error {
+	defer setBarStatus(bar, "")
+
+	restarted := false
+	for retry := 0; ; retry++ {
+		setBarStatus(bar, "queued")
+		release, err := loadDownloadSlots(config).acquire(ctx, downloadHost(url))
+		if err != nil {
+			return err
+		}
+		setBarStatus(bar, ternary(retry > 0, fmt.Sprintf("retry %d/%d", retry, config.DownloadRetries), ""))
+		err = fetch()
+		release()
+
+		if isRangeNotSatisfiable(err) && !restarted {
+			restarted = true
+			continue
+		}
+		if err == nil || retry >= config.DownloadRetries || !isTransient(err) {
+			return err
+		}
+
+		delay := retryDelay(err, retry+1)
+		setBarStatus(bar, fmt.Sprintf("retrying in %s (%d/%d)", delay.Round(time.Second), retry+1, config.DownloadRetries))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// barState is what is tracked of each progress bar: the retry state shown next to its title,
+// and how far it has been moved, so that a retry can move it back
+type barState struct {
+	mu       sync.Mutex
+	status   string
+	progress int64
+}
+
+var barStates sync.Map
+
+func stateOfBar(bar progressbar.PB) *barState {
+	state, _ := barStates.LoadOrStore(bar, &barState{})
+	return state.(*barState)
+}
+
+func setBarStatus(bar progressbar.PB, status string) {
+	if bar == nil {
+		return
+	}
+	state := stateOfBar(bar)
+	state.mu.Lock()
+	state.status = status
+	state.mu.Unlock()
+	// Redraw it
+	bar.Step(0)
+}
+
+// forgetBar drops what is tracked of bar, once the download it shows is over
+func forgetBar(bar progressbar.PB) {
+	if bar != nil {
+		barStates.Delete(bar)
+	}
+}
+
+// barStatus is meant for progressbar.WithBarOnDataPrepared, to show the retry state of bar
+func barStatus(bar progressbar.PB, data *progressbar.SchemaData) {
+	value, ok := barStates.Load(bar)
+	if !ok {
+		return
+	}
+	state := value.(*barState)
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if state.status != "" {
+		data.Title += " (" + state.status + ")"
+	}
+}
+
+// resetBar sets the total of bar and where it is at, whatever a previous attempt left it at
+func resetBar(bar progressbar.PB, total, done int64) {
+	state := stateOfBar(bar)
+	state.mu.Lock()
+	delta := done - state.progress
+	state.progress = done
+	state.mu.Unlock()
+
+	bar.UpdateRange(0, total)
+	bar.Step(delta)
+}
+
+// barWriter moves bar forward by what is written to it
+type barWriter struct {
+	bar progressbar.PB
+}
+
+func (w barWriter) Write(p []byte) (int, error) {
+	state := stateOfBar(w.bar)
+	state.mu.Lock()
+	state.progress += int64(len(p))
+	state.mu.Unlock()
+	return w.bar.Write(p)
+}
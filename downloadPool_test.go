@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsTransient(t *testing.T) {
+	urlErr := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://example.com/bin", Err: err}
+	}
+	statusErr := func(code int) error {
+		return newHTTPStatusError(&http.Response{StatusCode: code, Status: http.StatusText(code), Header: http.Header{}}, "https://example.com/bin")
+	}
+	opErr := func(err error) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", err)}
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"timeout", urlErr(timeoutError{}), true},
+		{"connection refused", urlErr(opErr(syscall.ECONNREFUSED)), true},
+		{"connection reset", urlErr(opErr(syscall.ECONNRESET)), true},
+		{"cut short", fmt.Errorf("reading body: %w", io.ErrUnexpectedEOF), true},
+		{"deadline exceeded", context.DeadlineExceeded, true},
+		{"503", statusErr(http.StatusServiceUnavailable), true},
+		{"429", statusErr(http.StatusTooManyRequests), true},
+		{"404", statusErr(http.StatusNotFound), false},
+		{"unknown certificate authority", urlErr(x509.UnknownAuthorityError{}), false},
+		{"unknown host", urlErr(&net.DNSError{Err: "no such host", Name: "example.com", IsNotFound: true}), false},
+		{"unsupported protocol scheme", urlErr(errors.New(`unsupported protocol scheme "ftp"`)), false},
+		{"canceled", urlErr(context.Canceled), false},
+	}
+	for _, test := range tests {
+		if got := isTransient(test.err); got != test.want {
+			t.Errorf("%s: isTransient(%v) = %v, want %v", test.name, test.err, got, test.want)
+		}
+	}
+}
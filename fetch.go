@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,43 +11,44 @@ import (
 
 	"github.com/goccy/go-json"
 	"github.com/hedzr/progressbar"
-	"github.com/zeebo/blake3"
 )
 
-func downloadWithProgress(ctx context.Context, bar progressbar.PB, resp *http.Response, destination, checksum string) error {
+func downloadWithProgress(ctx context.Context, config *Config, bar progressbar.PB, resp *http.Response, destination, checksum string) error {
 	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
 		return fmt.Errorf("failed to create parent directories for %s: %v", destination, err)
 	}
 
-	if bar != nil {
-		bar.UpdateRange(0, resp.ContentLength)
-	}
-
 	tempFile := destination + ".tmp"
-	out, err := os.Create(tempFile)
+	hash := newChecksumHasher(checksum)
+	out, offset, err := openPartialDownload(resp, tempFile, hash)
 	if err != nil {
+		discardPartialDownload(tempFile)
 		return err
 	}
 	defer out.Close()
+	savePartialDownload(resp, tempFile, checksum)
+
+	if bar != nil {
+		resetBar(bar, offset+resp.ContentLength, offset)
+	}
 
 	buf := make([]byte, 4096)
-	hash := blake3.New()
 
 downloadLoop:
 	for {
 		select {
 		case <-ctx.Done():
-			_ = os.Remove(tempFile)
+			keepPartialDownload(tempFile)
 			return ctx.Err()
 		default:
 			n, err := resp.Body.Read(buf)
 			if n > 0 {
 				var writer io.Writer = io.MultiWriter(out, hash)
 				if bar != nil {
-					writer = io.MultiWriter(out, hash, bar)
+					writer = io.MultiWriter(out, hash, barWriter{bar})
 				}
 				if _, err = writer.Write(buf[:n]); err != nil {
-					_ = os.Remove(tempFile)
+					discardPartialDownload(tempFile)
 					return err
 				}
 			}
@@ -56,19 +56,16 @@ downloadLoop:
 				break downloadLoop
 			}
 			if err != nil {
-				_ = os.Remove(tempFile)
+				keepPartialDownload(tempFile)
 				return err
 			}
 		}
 	}
+	_ = os.Remove(partialDownloadPath(tempFile))
 
-	if checksum != "" && checksum != "!no_check" {
-		calculatedChecksum := hex.EncodeToString(hash.Sum(nil))
-		if calculatedChecksum != checksum {
-			fmt.Fprintf(os.Stderr, "checksum verification failed: expected %s, got %s", checksum, calculatedChecksum)
-		}
-	} else {
-		fmt.Println("Warning: No checksum exists for this binary in the repository index, skipping verification.")
+	if err := verifyChecksum(config, filepath.Base(destination), checksum, hash); err != nil {
+		_ = os.Remove(tempFile)
+		return err
 	}
 
 	if err := removeNixGarbageFoundInTheRepos(tempFile); err != nil {
@@ -76,6 +73,11 @@ downloadLoop:
 		return err
 	}
 
+	if err := checkBinaryArch(config, tempFile); err != nil {
+		_ = os.Remove(tempFile)
+		return err
+	}
+
 	if err := os.Rename(tempFile, destination); err != nil {
 		_ = os.Remove(tempFile)
 		return err
@@ -89,68 +91,149 @@ downloadLoop:
 	return nil
 }
 
-func fetchBinaryFromURLToDest(ctx context.Context, bar progressbar.PB, url, checksum, destination string) (string, error) {
+func fetchBinaryFromURLToDest(ctx context.Context, config *Config, bar progressbar.PB, url, checksum, destination string) (string, error) {
+	defer forgetBar(bar)
+
+	if _, err := fetchBinaryFromStore(config, checksum, destination); err == nil {
+		if bar != nil {
+			resetBar(bar, 1, 1)
+		}
+		return destination, nil
+	}
+	if config.Offline {
+		return fetchBinaryFromCacheDir(config, checksum, destination)
+	}
+
+	health := loadMirrorHealth(config)
+	var errs []error
+	for _, candidate := range health.order("", downloadMirrors(config, url)) {
+		err := withRetries(ctx, config, bar, candidate, func() error {
+			_, err := fetchBinaryFromMirror(ctx, config, bar, candidate, checksum, destination)
+			return err
+		})
+		health.report("", candidate, err)
+		if err == nil {
+			if err := addToStore(config, destination, checksum); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+			return destination, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return "", joinMirrorErrors(errs)
+}
+
+func fetchBinaryFromMirror(ctx context.Context, config *Config, bar progressbar.PB, url, checksum, destination string) (string, error) {
 	if strings.HasPrefix(url, "oci://") {
 		url = strings.TrimPrefix(url, "oci://")
-		return fetchOCIImage(ctx, bar, url, checksum, destination)
+		return fetchOCIImage(ctx, config, bar, url, checksum, destination)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request for %s: %v", url, err)
+		return "", fmt.Errorf("failed to create request for %s: %v", redactURL(url), err)
 	}
 	req.Header.Set("Cache-Control", "no-cache, no-store, must-revalidate")
 	req.Header.Set("Pragma", "no-cache")
 	req.Header.Set("Expires", "0")
-	req.Header.Set("User-Agent", fmt.Sprintf("dbin/%s", Version))
+	if err := authorizeRequest(config, req); err != nil {
+		return "", err
+	}
 
-	client := &http.Client{}
+	client, err := httpClient(config)
+	if err != nil {
+		return "", err
+	}
+	resumeDownload(req, destination, checksum)
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 
-	if err := downloadWithProgress(ctx, bar, resp, destination, checksum); err != nil {
+	if err := checkDownloadStatus(resp, url, destination); err != nil {
+		return "", err
+	}
+
+	if err := downloadWithProgress(ctx, config, bar, resp, destination, checksum); err != nil {
 		return "", err
 	}
 
 	return destination, nil
 }
 
-func fetchOCIImage(ctx context.Context, bar progressbar.PB, ref, checksum, destination string) (string, error) {
-	parts := strings.SplitN(ref, ":", 2)
-	if len(parts) != 2 {
+func fetchOCIImage(ctx context.Context, config *Config, bar progressbar.PB, ref, checksum, destination string) (string, error) {
+	if config.Offline {
+		return "", fmt.Errorf("cannot pull %s while in offline mode", ref)
+	}
+
+	// The tag is what follows the last colon, which pins snapshots to their own tag rather than the latest
+	i := strings.LastIndex(ref, ":")
+	if i <= strings.LastIndex(ref, "/") {
 		return "", fmt.Errorf("invalid OCI reference format")
 	}
-	image, tag := parts[0], parts[1]
+	image, tag := ref[:i], ref[i+1:]
 
 	registry, repository := parseImage(image)
 
-	token, err := getAuthToken(registry, repository)
+	client, err := httpClient(config)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := getAuthToken(ctx, config, client, registry, repository)
 	if err != nil {
-		return "", fmt.Errorf("failed to get auth token: %v", err)
+		return "", fmt.Errorf("failed to get auth token: %w", err)
 	}
 
-	manifest, err := downloadManifest(ctx, registry, repository, tag, token)
+	manifest, err := downloadManifest(ctx, client, registry, repository, tag, token)
 	if err != nil {
-		return "", fmt.Errorf("failed to get manifest: %v", err)
+		return "", fmt.Errorf("failed to get manifest: %w", err)
 	}
 
 	title := filepath.Base(destination)
-	resp, err := downloadLayer(ctx, registry, repository, manifest, token, title)
+	resp, checksum, err := downloadLayer(ctx, client, registry, repository, manifest, token, title, destination, checksum)
 	if err != nil {
-		return "", fmt.Errorf("failed to get layer: %v", err)
+		return "", fmt.Errorf("failed to get layer: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if err := downloadWithProgress(ctx, bar, resp, destination, checksum); err != nil {
+	if err := checkDownloadStatus(resp, ref, destination); err != nil {
+		return "", err
+	}
+
+	if err := downloadWithProgress(ctx, config, bar, resp, destination, checksum); err != nil {
 		return "", err
 	}
 
 	return destination, nil
 }
 
+// fetchBinaryFromCacheDir looks for a copy of the binary in CacheDir, where `dbin run` keeps them,
+// whose checksum matches the one in the repository index. It is how installs that the store cannot
+// satisfy are satisfied while offline
+func fetchBinaryFromCacheDir(config *Config, checksum, destination string) (string, error) {
+	if !hasChecksum(checksum) {
+		return "", fmt.Errorf("cannot install %s while in offline mode: it has no checksum to match against a local copy", filepath.Base(destination))
+	}
+
+	candidate := filepath.Join(config.CacheDir, filepath.Base(destination))
+	if !fileMatchesChecksum(candidate, checksum) {
+		return "", fmt.Errorf("%s is not available locally and dbin is in offline mode", filepath.Base(destination))
+	}
+
+	if candidate != destination {
+		if err := copyFile(candidate, destination); err != nil {
+			return "", fmt.Errorf("failed to copy %s from %s: %v", filepath.Base(destination), config.CacheDir, err)
+		}
+	}
+
+	return destination, nil
+}
+
 func parseImage(image string) (string, string) {
 	parts := strings.SplitN(image, "/", 2)
 	if len(parts) == 1 {
@@ -159,14 +242,29 @@ func parseImage(image string) (string, string) {
 	return parts[0], parts[1]
 }
 
-func getAuthToken(registry, repository string) (string, error) {
+func getAuthToken(ctx context.Context, config *Config, client *http.Client, registry, repository string) (string, error) {
 	url := fmt.Sprintf("https://%s/token?service=%s&scope=repository:%s:pull", registry, registry, repository)
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	// Registries hand out pull tokens in exchange for the user's credentials, if any are configured
+	if auth, ok, err := hostCredentials(config, registry); err != nil {
+		return "", err
+	} else if ok && auth.Username != "" {
+		req.SetBasicAuth(auth.Username, ternary(auth.Password != "", auth.Password, auth.Token))
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return "", newHTTPStatusError(resp, url)
+	}
+
 	var tokenResponse struct {
 		Token string `json:"token"`
 	}
@@ -176,7 +274,7 @@ func getAuthToken(registry, repository string) (string, error) {
 	return tokenResponse.Token, nil
 }
 
-func downloadManifest(ctx context.Context, registry, repository, tag, token string) (map[string]interface{}, error) {
+func downloadManifest(ctx context.Context, client *http.Client, registry, repository, tag, token string) (map[string]interface{}, error) {
 	url := fmt.Sprintf("https://%s/v2/%s/manifests/%s", registry, repository, tag)
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
@@ -185,12 +283,16 @@ func downloadManifest(ctx context.Context, registry, repository, tag, token stri
 	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Accept", "application/vnd.oci.image.manifest.v1+json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, newHTTPStatusError(resp, url)
+	}
+
 	var manifest map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
 		return nil, err
@@ -198,16 +300,18 @@ func downloadManifest(ctx context.Context, registry, repository, tag, token stri
 	return manifest, nil
 }
 
-func downloadLayer(ctx context.Context, registry, repository string, manifest map[string]interface{}, token, title string) (*http.Response, error) {
+// downloadLayer requests the layer of manifest titled title. Along with the response it returns
+// the checksum to verify it against, which is the digest of the layer when none is known
+func downloadLayer(ctx context.Context, client *http.Client, registry, repository string, manifest map[string]interface{}, token, title, destination, checksum string) (*http.Response, string, error) {
 	layers, ok := manifest["layers"].([]interface{})
 	if !ok {
-		return nil, fmt.Errorf("invalid manifest structure")
+		return nil, "", fmt.Errorf("invalid manifest structure")
 	}
 
 	for _, layer := range layers {
 		layerMap, ok := layer.(map[string]interface{})
 		if !ok {
-			return nil, fmt.Errorf("invalid layer structure")
+			return nil, "", fmt.Errorf("invalid layer structure")
 		}
 
 		annotations := layerMap["annotations"].(map[string]interface{})
@@ -221,13 +325,18 @@ func downloadLayer(ctx context.Context, registry, repository string, manifest ma
 
 			req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 			if err != nil {
-				return nil, err
+				return nil, "", err
 			}
 			req.Header.Set("Authorization", "Bearer "+token)
+			if !hasChecksum(checksum) && strings.HasPrefix(digest, sha256ChecksumPrefix) {
+				checksum = digest
+			}
+			resumeDownload(req, destination, checksum)
 
-			return http.DefaultClient.Do(req)
+			resp, err := client.Do(req)
+			return resp, checksum, err
 		}
 	}
 
-	return nil, fmt.Errorf("file with title '%s' not found in manifest", title)
+	return nil, "", fmt.Errorf("file with title '%s' not found in manifest", title)
 }
@@ -7,110 +7,222 @@ import (
 	"strings"
 )
 
-func findMatchingBins(bEntry binaryEntry, uRepoIndex []binaryEntry) ([]binaryEntry, uint16) {
+func findMatchingBins(config *Config, bEntry binaryEntry, uRepoIndex *binaryIndex) []binaryEntry {
 	var matchingBins []binaryEntry
-	var highestRank uint16
 
-	for _, bin := range uRepoIndex {
-		if bin.Name == bEntry.Name && (bEntry.PkgId == "" || bin.PkgId == bEntry.PkgId) && (bEntry.Version == "" || bin.Version == bEntry.Version) {
-			matchingBins = append(matchingBins, bin)
-			if bin.Rank > highestRank {
-				highestRank = bin.Rank
+	// An invalid constraint matches nothing, findURL reports why
+	constraint, err := parseVersionConstraint(bEntry.Version)
+	if err != nil {
+		return nil
+	}
+
+	for _, bin := range uRepoIndex.candidates(bEntry) {
+		if (bEntry.PkgId != "" && bin.PkgId != bEntry.PkgId) || (bEntry.RepoName != "" && bin.RepoName != bEntry.RepoName) {
+			continue
+		}
+		if bEntry.Snapshot != "" {
+			if snapshotBin, ok := snapshotOf(bin, bEntry.Snapshot); ok {
+				matchingBins = append(matchingBins, snapshotBin)
 			}
+			continue
+		}
+		if constraint.matches(bin.Version) {
+			matchingBins = append(matchingBins, bin)
+		}
+		if bEntry.Version != "" {
+			matchingBins = append(matchingBins, matchingSnapshots(bin, constraint)...)
 		}
 	}
 
-	return matchingBins, highestRank
+	if pinned, ok := config.PinnedVariants[bEntry.Name]; ok && bEntry.PkgId == "" {
+		matchingBins = pinnedBins(matchingBins, pinned)
+	}
+	matchingBins = preferredRepoBins(config, matchingBins)
+	if bEntry.Version != "" && constraint.isRange() {
+		matchingBins = newestBins(matchingBins)
+	}
+
+	return matchingBins
 }
 
-func selectHighestRankedBin(matchingBins []binaryEntry, highestRank uint16) binaryEntry {
-	if len(matchingBins) == 1 {
-		return matchingBins[0]
+// pinnedBins keeps only the candidates with the pkg_id chosen for their name in PinnedVariants,
+// unless none of them has it anymore
+func pinnedBins(matchingBins []binaryEntry, pkgId string) []binaryEntry {
+	var pinned []binaryEntry
+	for _, bin := range matchingBins {
+		if bin.PkgId == pkgId {
+			pinned = append(pinned, bin)
+		}
+	}
+	return ternary(len(pinned) > 0, pinned, matchingBins)
+}
+
+// preferredRepoBins keeps only the candidates that come from the repository with the highest
+// priority in config.RepoPriorities, so that a package present in several repos is taken from one
+func preferredRepoBins(config *Config, matchingBins []binaryEntry) []binaryEntry {
+	if len(matchingBins) < 2 || len(config.RepoPriorities) == 0 {
+		return matchingBins
 	}
 
-	var nonGlibcBins []binaryEntry
+	highestPriority := config.RepoPriorities[matchingBins[0].RepoName]
+	for _, bin := range matchingBins[1:] {
+		if priority := config.RepoPriorities[bin.RepoName]; priority > highestPriority {
+			highestPriority = priority
+		}
+	}
+
+	var preferred []binaryEntry
 	for _, bin := range matchingBins {
-		if !strings.Contains(bin.PkgId, "glibc") {
-			nonGlibcBins = append(nonGlibcBins, bin)
+		if config.RepoPriorities[bin.RepoName] == highestPriority {
+			preferred = append(preferred, bin)
 		}
 	}
+	return preferred
+}
 
-	if len(nonGlibcBins) > 0 {
-		var selectedBin binaryEntry
-		var highestNonGlibcRank uint16
-		for _, bin := range nonGlibcBins {
-			if bin.Rank > highestNonGlibcRank {
-				highestNonGlibcRank = bin.Rank
-				selectedBin = bin
-			}
+// matchingSnapshots returns the snapshots of bin that satisfy constraint, as entries that pull
+// the snapshot's tag. Their checksum is not in the index, so they are verified against the digest of their layer
+func matchingSnapshots(bin binaryEntry, constraint versionConstraint) []binaryEntry {
+	if !strings.HasPrefix(bin.GhcrPkg, "oci://") {
+		return nil
+	}
+
+	var snapshots []binaryEntry
+	for _, snapshot := range bin.Snapshots {
+		tag, version := parseSnapshot(snapshot)
+		if compareVersions(version, bin.Version) == 0 || !constraint.matches(version) {
+			continue
 		}
-		return selectedBin
+		snapshots = append(snapshots, snapshotBin(bin, tag, version))
 	}
+	return snapshots
+}
 
-	for _, bin := range matchingBins {
-		if bin.Rank == highestRank {
-			return bin
+// snapshotOf returns the snapshot of bin whose tag is tag, as an entry that pulls it
+func snapshotOf(bin binaryEntry, tag string) (binaryEntry, bool) {
+	if !strings.HasPrefix(bin.GhcrPkg, "oci://") {
+		return binaryEntry{}, false
+	}
+	for _, snapshot := range bin.Snapshots {
+		if snapshotTag, version := parseSnapshot(snapshot); snapshotTag == tag {
+			return snapshotBin(bin, snapshotTag, version), true
 		}
 	}
+	return binaryEntry{}, false
+}
+
+// snapshotBin turns bin into the entry of its snapshot tagged tag. It remembers the tag, so that
+// the binary is recorded as installed from that snapshot and left alone by updates
+func snapshotBin(bin binaryEntry, tag, version string) binaryEntry {
+	bin.Version = version
+	bin.GhcrPkg = withOCITag(bin.GhcrPkg, tag)
+	bin.Bsum = ""
+	bin.Shasum = ""
+	bin.Snapshot = tag
+	return bin
+}
 
-	if highestRank == 0 {
-		return matchingBins[0]
+// newestBins keeps only the highest version of each variant (pkg_id and repository) among the
+// candidates, so that a variant that cannot run or that the VariantPolicy avoids does not hide
+// an older version of the others from selectVariant
+func newestBins(matchingBins []binaryEntry) []binaryEntry {
+	if len(matchingBins) < 2 {
+		return matchingBins
+	}
+
+	variant := func(bin binaryEntry) string {
+		return bin.RepoName + "\x00" + bin.PkgId
+	}
+	newest := make(map[string]string)
+	for _, bin := range matchingBins {
+		if version, ok := newest[variant(bin)]; !ok || compareVersions(bin.Version, version) > 0 {
+			newest[variant(bin)] = bin.Version
+		}
 	}
 
-	return binaryEntry{}
+	var newestBins []binaryEntry
+	for _, bin := range matchingBins {
+		if compareVersions(bin.Version, newest[variant(bin)]) == 0 {
+			newestBins = append(newestBins, bin)
+		}
+	}
+	return newestBins
 }
 
-func findURL(config *Config, bEntries []binaryEntry, verbosityLevel Verbosity, uRepoIndex []binaryEntry) ([]string, []string, error) {
+// findURL resolves each entry to the URL and checksum to fetch it from. Entries that cannot be
+// resolved get "!not_found", and the reason why at their position in the returned errors
+func findURL(config *Config, bEntries []binaryEntry, verbosityLevel Verbosity, uRepoIndex *binaryIndex) ([]string, []string, []error, error) {
 	var foundURLs []string
 	var foundB3sum []string
-	var allErrors []error
+	entryErrors := make([]error, len(bEntries))
 	allFailed := true
 
-	for _, bEntry := range bEntries {
+	for i, bEntry := range bEntries {
 		parsedURL, err := url.ParseRequestURI(bEntry.Name)
 		if err == nil && parsedURL.Scheme != "" && parsedURL.Host != "" {
 			if verbosityLevel >= extraVerbose {
-				fmt.Printf("\033[2K\rFound \"%s\" is already a valid URL", bEntry.Name)
+				fmt.Printf("\033[2K\rFound \"%s\" is already a valid URL", redactURL(bEntry.Name))
 			}
 			foundURLs = append(foundURLs, bEntry.Name)
-			foundB3sum = append(foundB3sum, "!no_check")
+			foundB3sum = append(foundB3sum, ternary(entryChecksum(bEntry) != "", entryChecksum(bEntry), "!no_check"))
 			allFailed = false
 			continue
 		}
 
 		if instBEntry := bEntryOfinstalledBinary(filepath.Join(config.InstallDir, bEntry.Name)); instBEntry.Name != "" {
+			instBEntry.Version, instBEntry.Snapshot = bEntry.Version, bEntry.Snapshot
 			bEntry = instBEntry
 		}
 
-		matchingBins, highestRank := findMatchingBins(bEntry, uRepoIndex)
+		if _, err := parseVersionConstraint(bEntry.Version); err != nil {
+			foundURLs = append(foundURLs, "!not_found")
+			foundB3sum = append(foundB3sum, "!no_check")
+			entryErrors[i] = fmt.Errorf("[%s]: %v", parseBinaryEntry(bEntry, false), err)
+			continue
+		}
+
+		if providers := ambiguousProviders(config, bEntry, uRepoIndex); len(providers) > 0 {
+			foundURLs = append(foundURLs, "!not_found")
+			foundB3sum = append(foundB3sum, "!no_check")
+			entryErrors[i] = ambiguousProvidersError(bEntry, providers)
+			continue
+		}
+
+		matchingBins := findMatchingBins(config, bEntry, uRepoIndex)
 
 		if len(matchingBins) == 0 {
 			foundURLs = append(foundURLs, "!not_found")
 			foundB3sum = append(foundB3sum, "!no_check")
-			allErrors = append(allErrors, fmt.Errorf("didn't find download URL for [%s]", parseBinaryEntry(bEntry, false)))
+			entryErrors[i] = fmt.Errorf("%s", notFoundMessage(bEntry, uRepoIndex))
 			continue
 		}
 
+		selectedBin, _ := selectVariant(config, matchingBins)
+		if selectedBin.Name == "" {
+			foundURLs = append(foundURLs, "!not_found")
+			foundB3sum = append(foundB3sum, "!no_check")
+			entryErrors[i] = fmt.Errorf("none of the variants of [%s] can run on this system (libc: %s), see `dbin info --explain %s`", parseBinaryEntry(bEntry, false), hostLibc(config), bEntry.Name)
+			continue
+		}
 		allFailed = false
-		selectedBin := selectHighestRankedBin(matchingBins, highestRank)
 
 		url := ternary(selectedBin.GhcrPkg != "", selectedBin.GhcrPkg, selectedBin.DownloadURL)
 		foundURLs = append(foundURLs, url)
-		foundB3sum = append(foundB3sum, selectedBin.Bsum)
+		foundB3sum = append(foundB3sum, entryChecksum(selectedBin))
 
 		if verbosityLevel >= extraVerbose {
-			fmt.Printf("\033[2K\rFound \"%s\" with id=%s version=%s", bEntry.Name, selectedBin.PkgId, selectedBin.Version)
+			fmt.Printf("\033[2K\rFound \"%s\" with id=%s version=%s repo=%s", bEntry.Name, selectedBin.PkgId, selectedBin.Version, selectedBin.RepoName)
 		}
 	}
 
 	if allFailed {
 		var errorMessages []string
-		for _, e := range allErrors {
+		for _, e := range entryErrors {
 			errorMessages = append(errorMessages, e.Error())
 		}
-		return nil, nil, fmt.Errorf(ternary(len(bEntries) != 1, "error: no valid download URLs found for any of the requested binaries.\n%s\n", "%s\n"), strings.Join(errorMessages, "\n"))
+		return nil, nil, nil, fmt.Errorf(ternary(len(bEntries) != 1, "error: no valid download URLs found for any of the requested binaries.\n%s\n", "%s\n"), strings.Join(errorMessages, "\n"))
 	}
 
-	return foundURLs, foundB3sum, nil
+	return foundURLs, foundB3sum, entryErrors, nil
 }
 
@@ -12,6 +12,7 @@ require (
 	github.com/tdewolff/minify/v2 v2.21.3
 	github.com/urfave/cli/v3 v3.0.0-beta1
 	github.com/zeebo/blake3 v0.2.4
+	golang.org/x/sys v0.30.0
 	golang.org/x/term v0.29.0
 )
 
@@ -20,5 +21,4 @@ require (
 	github.com/tdewolff/parse/v2 v2.7.20 // indirect
 	github.com/x448/float16 v0.8.4 // indirect
 	golang.org/x/net v0.35.0 // indirect
-	golang.org/x/sys v0.30.0 // indirect
 )
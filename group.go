@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v3"
+)
+
+func groupCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "group",
+		Usage: "Show the groups of binaries defined under Groups in the config",
+		Commands: []*cli.Command{
+			{
+				Name:  "list",
+				Usage: "List the groups and how many of their members are installed",
+				Action: func(ctx context.Context, c *cli.Command) error {
+					config, err := loadConfig(c)
+					if err != nil {
+						return err
+					}
+					if len(config.Groups) == 0 {
+						fmt.Println("No groups are defined, add them under Groups in the config")
+						return nil
+					}
+
+					w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+					fmt.Fprintln(w, "GROUP\tINSTALLED\tMEMBERS")
+					for _, name := range groupNames(config) {
+						members, err := expandGroups(config, []string{"@" + name})
+						if err != nil {
+							return err
+						}
+						installed := 0
+						for _, member := range members {
+							if groupMemberInstalled(config, member) {
+								installed++
+							}
+						}
+						fmt.Fprintf(w, "@%s\t%d/%d\t%s\n", name, installed, len(members), strings.Join(config.Groups[name], " "))
+					}
+					return w.Flush()
+				},
+			},
+			{
+				Name:      "show",
+				Usage:     "Show the members of a group and which of them are installed",
+				ArgsUsage: "<group>",
+				Action: func(ctx context.Context, c *cli.Command) error {
+					config, err := loadConfig(c)
+					if err != nil {
+						return err
+					}
+					name := strings.TrimPrefix(c.Args().First(), "@")
+					if name == "" {
+						return fmt.Errorf("no group provided")
+					}
+					members, err := expandGroups(config, []string{"@" + name})
+					if err != nil {
+						return err
+					}
+
+					w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+					fmt.Fprintln(w, "MEMBER\tSTATUS")
+					for _, member := range members {
+						fmt.Fprintf(w, "%s\t%s\n", member, ternary(groupMemberInstalled(config, member), "installed", "not installed"))
+					}
+					return w.Flush()
+				},
+			},
+		},
+	}
+}
+
+func groupNames(config *Config) []string {
+	names := make([]string, 0, len(config.Groups))
+	for name := range config.Groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// expandGroups replaces every "@group" in args with the package specifiers of that group, which
+// may themselves name other groups. Each specifier is only kept once, in the order it first appears
+func expandGroups(config *Config, args []string) ([]string, error) {
+	var expanded []string
+	seen := make(map[string]bool)
+
+	var expand func(args []string, path []string) error
+	expand = func(args []string, path []string) error {
+		for _, arg := range args {
+			if !strings.HasPrefix(arg, "@") {
+				if !seen[arg] {
+					seen[arg] = true
+					expanded = append(expanded, arg)
+				}
+				continue
+			}
+
+			name := arg[1:]
+			members, ok := config.Groups[name]
+			if !ok {
+				return fmt.Errorf("there is no group named %s, the groups are: %s", arg, ternary(len(config.Groups) > 0, "@"+strings.Join(groupNames(config), ", @"), "none"))
+			}
+			for _, parent := range path {
+				if parent == name {
+					return fmt.Errorf("group %s includes itself through @%s", arg, strings.Join(append(path, name), " -> @"))
+				}
+			}
+			if err := expand(members, append(path, name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := expand(args, nil); err != nil {
+		return nil, err
+	}
+	return expanded, nil
+}
+
+// groupMemberInstalled reports whether the package a group member names is installed, with the
+// pkg_id it asks for, if any
+func groupMemberInstalled(config *Config, member string) bool {
+	bEntry := stringToBinaryEntry(member)
+	if strings.Contains(bEntry.Name, "://") {
+		return fileExists(filepath.Join(config.InstallDir, filepath.Base(bEntry.Name)))
+	}
+	instBEntry := bEntryOfinstalledBinary(filepath.Join(config.InstallDir, filepath.Base(bEntry.Name)))
+	return instBEntry.Name != "" && (bEntry.PkgId == "" || instBEntry.PkgId == bEntry.PkgId)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	sharedClient     *http.Client
+	sharedClientErr  error
+	sharedClientOnce sync.Once
+)
+
+// httpClient returns the client every network request of dbin goes through. It is built once
+// from the Proxy, CABundle, ConnectTimeout and ReadTimeout settings and keeps connections alive
+// between requests, so fetching many binaries from the same host reuses them
+func httpClient(config *Config) (*http.Client, error) {
+	sharedClientOnce.Do(func() {
+		sharedClient, sharedClientErr = newHTTPClient(config)
+	})
+	return sharedClient, sharedClientErr
+}
+
+func newHTTPClient(config *Config) (*http.Client, error) {
+	proxy := http.ProxyFromEnvironment
+	if config.Proxy != "" {
+		proxyURL, err := url.Parse(config.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy %s: %v", redactURL(config.Proxy), err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig := &tls.Config{}
+	if config.CABundle != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(config.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the CA bundle: %v", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in the CA bundle %s", config.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	connectTimeout := time.Duration(config.ConnectTimeout) * time.Second
+	readTimeout := time.Duration(config.ReadTimeout) * time.Second
+	dialer := &net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := &http.Transport{
+		Proxy: proxy,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil || readTimeout <= 0 {
+				return conn, err
+			}
+			return &readTimeoutConn{Conn: conn, timeout: readTimeout}, nil
+		},
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: readTimeout,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+	}
+
+	return &http.Client{Transport: &userAgentTransport{base: transport}}, nil
+}
+
+// readTimeoutConn fails a read that receives nothing for timeout. Unlike http.Client.Timeout,
+// it does not limit how long a large download may take as long as data keeps arriving
+type readTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *readTimeoutConn) Read(b []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+type userAgentTransport struct {
+	base http.RoundTripper
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", "dbin/"+Version)
+	}
+	return t.base.RoundTrip(req)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
 	"context"
 
 	"github.com/urfave/cli/v3"
@@ -12,12 +13,21 @@ func infoCommand() *cli.Command {
 	return &cli.Command{
 		Name:  "info",
 		Usage: "Show information about a specific binary OR display installed binaries",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "explain",
+				Usage: "Explain why this variant of the binary is the one that would be installed",
+			},
+		},
 		Action: func(ctx context.Context, c *cli.Command) error {
-			config, err := loadConfig()
+			config, err := loadConfig(c)
+			if err != nil {
+				return err
+			}
+			uRepoIndex, err := fetchRepoIndex(ctx, config)
 			if err != nil {
 				return err
 			}
-			uRepoIndex := fetchRepoIndex(config)
 			var bEntry binaryEntry
 			if c.Args().First() != "" {
 				bEntry = stringToBinaryEntry(c.Args().First())
@@ -38,6 +48,13 @@ func infoCommand() *cli.Command {
 					fmt.Println(program)
 				}
 			} else {
+				if c.Bool("explain") {
+					_, explanation := selectVariant(config, findMatchingBins(config, trackedBEntry(config, bEntry), uRepoIndex))
+					fmt.Printf("Host libc: %s\n", ternary(hostLibc(config) != "", hostLibc(config), "unknown"))
+					for _, line := range explanation {
+						fmt.Println(line)
+					}
+				}
 				binaryInfo, err := getBinaryInfo(config, bEntry, uRepoIndex)
 				if err != nil {
 					return err
@@ -60,10 +77,12 @@ func infoCommand() *cli.Command {
 					{"Build Date", binaryInfo.BuildDate},
 					{"Build Script", binaryInfo.BuildScript},
 					{"Build Log", binaryInfo.BuildLog},
-					{"Categories", binaryInfo.Categories},
+					{"Categories", strings.Join(parseCategories(binaryInfo.Categories), ", ")},
 					{"Rank", binaryInfo.Rank},
 					{"Snapshots", binaryInfo.Snapshots},
 					{"Extra Bins", binaryInfo.ExtraBins},
+					{"Repository", binaryInfo.RepoName},
+					{"Repository URL", binaryInfo.RepoURL},
 				}
 				for _, field := range fields {
 					switch v := field.value.(type) {
@@ -87,27 +106,40 @@ func infoCommand() *cli.Command {
 	}
 }
 
-func findBinaryInfo(bEntry binaryEntry, uRepoIndex []binaryEntry) (binaryEntry, bool) {
-	matchingBins, highestRank := findMatchingBins(bEntry, uRepoIndex)
+func findBinaryInfo(config *Config, bEntry binaryEntry, uRepoIndex *binaryIndex) (binaryEntry, bool) {
+	if len(ambiguousProviders(config, bEntry, uRepoIndex)) > 0 {
+		return binaryEntry{}, false
+	}
+	matchingBins := findMatchingBins(config, bEntry, uRepoIndex)
 
 	if len(matchingBins) == 0 {
 		return binaryEntry{}, false
 	}
 
-	selectedBin := selectHighestRankedBin(matchingBins, highestRank)
+	selectedBin, _ := selectVariant(config, matchingBins)
 
-	return selectedBin, true
+	return selectedBin, selectedBin.Name != ""
 }
 
-func getBinaryInfo(config *Config, bEntry binaryEntry, uRepoIndex []binaryEntry) (*binaryEntry, error) {
+// trackedBEntry narrows bEntry down to the pkg_id of the installed binary of the same name, if any
+func trackedBEntry(config *Config, bEntry binaryEntry) binaryEntry {
 	if instBEntry := bEntryOfinstalledBinary(filepath.Join(config.InstallDir, bEntry.Name)); bEntry.PkgId == "" && instBEntry.PkgId != "" {
-		bEntry = instBEntry
+		instBEntry.Version, instBEntry.Snapshot = bEntry.Version, bEntry.Snapshot
+		return instBEntry
 	}
+	return bEntry
+}
 
-	binInfo, found := findBinaryInfo(bEntry, uRepoIndex)
+func getBinaryInfo(config *Config, bEntry binaryEntry, uRepoIndex *binaryIndex) (*binaryEntry, error) {
+	bEntry = trackedBEntry(config, bEntry)
+
+	binInfo, found := findBinaryInfo(config, bEntry, uRepoIndex)
 	if found {
 		return &binInfo, nil
 	}
+	if providers := ambiguousProviders(config, bEntry, uRepoIndex); len(providers) > 0 {
+		return nil, ambiguousProvidersError(bEntry, providers)
+	}
 
 	return nil, fmt.Errorf("error: info for the requested binary ('%s') not found in any of the repository index files", parseBinaryEntry(bEntry, false))
 }
@@ -17,24 +17,56 @@ func installCommand() *cli.Command {
 		Name:    "install",
 		Aliases: []string{"add"},
 		Usage:   "Install binaries",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "fuzzy",
+				Usage: "Offer to install the closest match of the names that are not found",
+			},
+			&cli.BoolFlag{
+				Name:  "strict",
+				Usage: "Fail instead of choosing when a name matches several variants",
+			},
+		},
 		Action: func(ctx context.Context, c *cli.Command) error {
-			config, err := loadConfig()
+			config, err := loadConfig(c)
+			if err != nil {
+				return err
+			}
+			uRepoIndex, err := fetchRepoIndex(ctx, config)
+			if err != nil {
+				return err
+			}
+			args, err := expandGroups(config, c.Args().Slice())
 			if err != nil {
 				return err
 			}
-			uRepoIndex := fetchRepoIndex(config)
-			return installBinaries(context.Background(), config, arrStringToArrBinaryEntry(c.Args().Slice()), getVerbosityLevel(c), uRepoIndex)
+			bEntries := arrStringToArrBinaryEntry(args)
+			if c.Bool("fuzzy") {
+				bEntries = correctTypos(config, bEntries, uRepoIndex)
+			}
+			if bEntries, err = pickVariants(config, bEntries, uRepoIndex, c.Bool("strict")); err != nil {
+				return err
+			}
+			bEntries = resolveProvidedNames(config, bEntries, getVerbosityLevel(c), uRepoIndex)
+			bEntries = addProvidedPackages(config, bEntries, getVerbosityLevel(c), uRepoIndex)
+			return installBinaries(ctx, config, bEntries, getVerbosityLevel(c), uRepoIndex)
 		},
 	}
 }
 
-func installBinaries(ctx context.Context, config *Config, bEntries []binaryEntry, verbosityLevel Verbosity, uRepoIndex []binaryEntry) error {
+func installBinaries(ctx context.Context, config *Config, bEntries []binaryEntry, verbosityLevel Verbosity, uRepoIndex *binaryIndex) error {
 	cursor.Hide()
 	defer cursor.Show()
 
 	var wg sync.WaitGroup
+	var errorsMu sync.Mutex
 	var errors []string
-	urls, checksums, err := findURL(config, bEntries, verbosityLevel, uRepoIndex)
+	addError := func(format string, args ...interface{}) {
+		errorsMu.Lock()
+		errors = append(errors, fmt.Sprintf(format, args...))
+		errorsMu.Unlock()
+	}
+	urls, checksums, entryErrors, err := findURL(config, bEntries, verbosityLevel, uRepoIndex)
 	if err != nil {
 		return err
 	}
@@ -65,7 +97,7 @@ func installBinaries(ctx context.Context, config *Config, bEntries []binaryEntry
 
 		// Skip fetch if URL is "!not_found"
 		if url == "!not_found" {
-			errors = append(errors, fmt.Sprintf("error: didn't find download URL for [%s]", bEntry.Name))
+			addError("error: %v", entryErrors[i])
 			wg.Done()
 			continue
 		}
@@ -74,6 +106,7 @@ func installBinaries(ctx context.Context, config *Config, bEntries []binaryEntry
 			barTitle := fmt.Sprintf("Installing %s", bEntry.Name)
 			pbarOpts := []progressbar.Opt{
 				progressbar.WithBarStepper(config.ProgressbarStyle),
+				progressbar.WithBarOnDataPrepared(barStatus),
 			}
 
 			if termWidth < 120 {
@@ -90,54 +123,76 @@ func installBinaries(ctx context.Context, config *Config, bEntries []binaryEntry
 				progressbar.WithTaskAddBarOptions(pbarOpts...),
 				progressbar.WithTaskAddOnTaskProgressing(func(bar progressbar.PB, exitCh <-chan struct{}) {
 					defer wg.Done()
-					_, fetchErr := fetchBinaryFromURLToDest(ctx, bar, url, checksum, destination)
+					_, fetchErr := fetchBinaryFromURLToDest(ctx, config, bar, url, checksum, destination)
 					if fetchErr != nil {
-						errors = append(errors, fmt.Sprintf("error: error fetching binary %s: %v", bEntry.Name, fetchErr))
+						addError("error: error fetching binary %s: %v", bEntry.Name, fetchErr)
 						return
 					}
 
 					if err := os.Chmod(destination, 0755); err != nil {
-						errors = append(errors, fmt.Sprintf("error: error making binary executable %s: %v", destination, err))
+						addError("error: error making binary executable %s: %v", destination, err)
 						return
 					}
 
 					if err := runIntegrationHooks(config, destination, verbosityLevel, uRepoIndex); err != nil {
-						errors = append(errors, fmt.Sprintf("error: [%s] could not be handled by its default hooks: %v", bEntry.Name, err))
+						addError("error: [%s] could not be handled by its default hooks: %v", bEntry.Name, err)
 						return
 					}
 
-					binInfo, _ := getBinaryInfo(config, bEntry, uRepoIndex)
+					binInfo, err := getBinaryInfo(config, bEntry, uRepoIndex)
+					if err != nil {
+						// Binaries installed from a URL are in no index, there is nothing to record about them
+						return
+					}
 					if err := embedBEntry(destination, *binInfo); err != nil {
-						errors = append(errors, fmt.Sprintf("error: failed to add fullName property to the binary's xattr %s: %v", destination, err))
+						addError("error: failed to add fullName property to the binary's xattr %s: %v", destination, err)
 						return
 					}
+
+					if err := linkProvidedBins(destination, *binInfo); err != nil {
+						addError("error: [%s] was installed, but %v", bEntry.Name, err)
+					}
+					if err := recordProvidedPackages(config, destination, *binInfo, uRepoIndex); err != nil {
+						addError("error: [%s] was installed, but %v", bEntry.Name, err)
+					}
 				}),
 			)
 		} else {
 			go func(bEntry binaryEntry, url, checksum, destination string) {
 				defer wg.Done()
-				_, fetchErr := fetchBinaryFromURLToDest(ctx, nil, url, checksum, destination)
+				_, fetchErr := fetchBinaryFromURLToDest(ctx, config, nil, url, checksum, destination)
 				if fetchErr != nil {
-					errors = append(errors, fmt.Sprintf("error: error fetching binary %s: %v", bEntry.Name, fetchErr))
+					addError("error: error fetching binary %s: %v", bEntry.Name, fetchErr)
 					return
 				}
 
 				if err := os.Chmod(destination, 0755); err != nil {
-					errors = append(errors, fmt.Sprintf("error: error making binary executable %s: %v", destination, err))
+					addError("error: error making binary executable %s: %v", destination, err)
 					return
 				}
 
 				if err := runIntegrationHooks(config, destination, verbosityLevel, uRepoIndex); err != nil {
-					errors = append(errors, fmt.Sprintf("error: [%s] could not be handled by its default hooks: %v", bEntry.Name, err))
+					addError("error: [%s] could not be handled by its default hooks: %v", bEntry.Name, err)
 					return
 				}
 
-				binInfo, _ := getBinaryInfo(config, bEntry, uRepoIndex)
+				binInfo, err := getBinaryInfo(config, bEntry, uRepoIndex)
+				if err != nil {
+					// Binaries installed from a URL are in no index, there is nothing to record about them
+					return
+				}
 				if err := embedBEntry(destination, *binInfo); err != nil {
-					errors = append(errors, fmt.Sprintf("error: failed to add fullName property to the binary's xattr %s: %v", destination, err))
+					addError("error: failed to add fullName property to the binary's xattr %s: %v", destination, err)
 					return
 				}
 
+				if err := linkProvidedBins(destination, *binInfo); err != nil {
+					addError("error: [%s] was installed, but %v", bEntry.Name, err)
+				}
+				if err := recordProvidedPackages(config, destination, *binInfo, uRepoIndex); err != nil {
+					addError("error: [%s] was installed, but %v", bEntry.Name, err)
+				}
+
 				if verbosityLevel >= normalVerbosity {
 					fmt.Printf("Successfully installed [%s]\n", binInfo.Name+"#"+binInfo.PkgId)
 				}
@@ -147,19 +202,31 @@ func installBinaries(ctx context.Context, config *Config, bEntries []binaryEntry
 
 	wg.Wait()
 
+	if err := trimStore(config); err != nil && verbosityLevel >= silentVerbosityWithErrors {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	if !config.Offline {
+		if err := loadMirrorHealth(config).save(); err != nil && verbosityLevel >= extraVerbose {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save the state of the mirrors: %v\n", err)
+		}
+	}
+
 	if len(errors) > 0 {
 		var errN = uint8(0)
 		for _, errMsg := range errors {
 			errN += 1
 			fmt.Printf("%d. %v\n", errN, errMsg)
 		}
+		return fmt.Errorf("%d error(s) while installing the requested binaries", len(errors))
 	}
 
 	return nil
 }
 
-func runIntegrationHooks(config *Config, binaryPath string, verbosityLevel Verbosity, uRepoIndex []binaryEntry) error {
-	if config.UseIntegrationHooks {
+func runIntegrationHooks(config *Config, binaryPath string, verbosityLevel Verbosity, uRepoIndex *binaryIndex) error {
+	// Binaries staged for another architecture are not meant to be integrated into this system
+	if config.UseIntegrationHooks && !isCrossArch(config) {
 		ext := filepath.Ext(binaryPath)
 		if hookCommands, exists := config.Hooks.Commands[ext]; exists {
 			for _, cmd := range hookCommands.IntegrationCommands {
@@ -16,17 +16,25 @@ func listCommand() *cli.Command {
 				Name:  "described",
 				Usage: "List binaries with descriptions",
 			},
+			&cli.StringFlag{
+				Name:  "category",
+				Usage: "Only list the binaries in this category (see `dbin categories`)",
+			},
 		},
 		Action: func(ctx context.Context, c *cli.Command) error {
-			config, err := loadConfig()
+			config, err := loadConfig(c)
+			if err != nil {
+				return err
+			}
+			uRepoIndex, err := fetchRepoIndex(ctx, config)
 			if err != nil {
 				return err
 			}
-			uRepoIndex := fetchRepoIndex(config)
+			category := c.String("category")
 			if c.Bool("described") {
-				return fSearch(config, []string{""}, uRepoIndex)
+				return fSearch(config, []string{ternary(category != "", categoryFilterPrefix+category, "")}, uRepoIndex)
 			}
-			bEntries, err := listBinaries(uRepoIndex)
+			bEntries, err := listBinaries(uRepoIndex, category)
 			if err != nil {
 				return err
 			}
@@ -38,11 +46,15 @@ func listCommand() *cli.Command {
 	}
 }
 
-func listBinaries(uRepoIndex []binaryEntry) ([]binaryEntry, error) {
+// listBinaries returns every binary in the index, or only those in category when it is not empty
+func listBinaries(uRepoIndex *binaryIndex, category string) ([]binaryEntry, error) {
 	var allBinaries []binaryEntry
 
-	for _, bin := range uRepoIndex {
-		name, pkgId, version, description, rank := bin.Name, bin.PkgId, bin.Version, bin.Description, bin.Rank
+	for i, bin := range uRepoIndex.entries {
+		if category != "" && !uRepoIndex.inCategory(i, category) {
+			continue
+		}
+		name, pkgId, version, description, rank, repoName := bin.Name, bin.PkgId, bin.Version, bin.Description, bin.Rank, bin.RepoName
 
 		if name != "" {
 			allBinaries = append(allBinaries, binaryEntry{
@@ -51,9 +63,14 @@ func listBinaries(uRepoIndex []binaryEntry) ([]binaryEntry, error) {
 				Version:     version,
 				Description: description,
 				Rank:        rank,
+				RepoName:    repoName,
 			})
 		}
 	}
 
+	if category != "" && len(allBinaries) == 0 {
+		return nil, fmt.Errorf("no binaries found in the category '%s', see `dbin categories`", category)
+	}
+
 	return allBinaries, nil
 }
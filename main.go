@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"context"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/urfave/cli/v3"
 )
@@ -41,6 +46,26 @@ func main() {
 				Name:  "extra-silent",
 				Usage: "Run in extra silent mode, suppressing almost all output",
 			},
+			&cli.BoolFlag{
+				Name:  "refresh",
+				Usage: "Ignore the cached repository indexes and fetch them again",
+			},
+			&cli.BoolFlag{
+				Name:  "offline",
+				Usage: "Never touch the network, use only the cached indexes and binaries",
+			},
+			&cli.BoolFlag{
+				Name:  "require-all-repos",
+				Usage: "Fail instead of continuing with a partial index when a repository cannot be fetched",
+			},
+			&cli.StringFlag{
+				Name:  "arch",
+				Usage: "Install binaries for another architecture, such as arm64_linux, using the {{arch}} in RepoURLs",
+			},
+			&cli.StringFlag{
+				Name:  "install-dir",
+				Usage: "Install binaries to this directory instead of InstallDir",
+			},
 		},
 		Commands: []*cli.Command{
 			installCommand(),
@@ -50,11 +75,19 @@ func main() {
 			infoCommand(),
 			runCommand(),
 			updateCommand(),
+			repoCommand(),
+			versionsCommand(),
+			groupCommand(),
+			categoriesCommand(),
+			storeCommand(),
 		},
 		EnableShellCompletion: true,
 	}
 
-	err := app.Run(context.Background(), os.Args)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := app.Run(ctx, os.Args)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
@@ -72,15 +105,90 @@ func getVerbosityLevel(c *cli.Command) Verbosity {
 	return normalVerbosity
 }
 
-func fetchRepoIndex(config *Config) []binaryEntry {
-	var uRepoIndex []binaryEntry
+// repoFetchError records why a single repository index could not be loaded
+type repoFetchError struct {
+	URL string
+	Err error
+}
+
+// repoFetchReport aggregates the failures of a fetchRepoIndex run
+type repoFetchReport struct {
+	Total    int
+	Failures []repoFetchError
+}
+
+func (r *repoFetchReport) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "failed to fetch %d of %d repository indexes:", len(r.Failures), r.Total)
+	for _, failure := range r.Failures {
+		fmt.Fprintf(&sb, "\n  %s: %v", redactURL(failure.URL), failure.Err)
+	}
+	return sb.String()
+}
+
+func (r *repoFetchReport) allFailed() bool {
+	return r.Total > 0 && len(r.Failures) == r.Total
+}
+
+func enabledRepoURLs(config *Config) []string {
+	var repoURLs []string
 	for _, url := range config.RepoURLs {
-		repoIndex, err := decodeRepoIndex(url)
-		if err != nil {
-			fmt.Printf("failed to fetch and decode binary information from %s: %v\n", url, err)
+		if !config.Repos[url].Disabled {
+			repoURLs = append(repoURLs, url)
+		}
+	}
+	return repoURLs
+}
+
+func fetchRepoIndex(ctx context.Context, config *Config) (*binaryIndex, error) {
+	var wg sync.WaitGroup
+	repoURLs := enabledRepoURLs(config)
+	results := make([][]binaryEntry, len(repoURLs))
+	errs := make([]error, len(repoURLs))
+
+	for i, url := range repoURLs {
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+			repoCtx, cancel := context.WithCancel(ctx)
+			if config.RepoFetchTimeout > 0 {
+				repoCtx, cancel = context.WithTimeout(ctx, time.Duration(config.RepoFetchTimeout)*time.Second)
+			}
+			defer cancel()
+			results[i], errs[i] = decodeRepoIndex(repoCtx, config, url)
+		}(i, url)
+	}
+	wg.Wait()
+
+	if !config.Offline {
+		if err := loadMirrorHealth(config).save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save the state of the mirrors: %v\n", err)
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	report := &repoFetchReport{Total: len(repoURLs)}
+	var entries []binaryEntry
+	for i, url := range repoURLs {
+		if errs[i] != nil {
+			report.Failures = append(report.Failures, repoFetchError{URL: url, Err: errs[i]})
 			continue
 		}
-		uRepoIndex = append(uRepoIndex, repoIndex...)
+		entries = append(entries, results[i]...)
 	}
-	return uRepoIndex
+
+	if len(report.Failures) > 0 {
+		if report.allFailed() && config.Offline {
+			return nil, fmt.Errorf("%v\nnone of the repository indexes have been cached yet, run dbin once without --offline", report)
+		}
+		if report.allFailed() || config.RequireAllRepos {
+			return nil, report
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %v\nContinuing with a partial index.\n", report)
+	}
+
+	return newBinaryIndex(entries), nil
 }
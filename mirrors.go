@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// A host that failed more recently than it last worked is tried last until this much time has passed
+const mirrorFailureCooldown = 10 * time.Minute
+
+type hostHealth struct {
+	LastSuccess time.Time `cbor:"last_success"`
+	LastFailure time.Time `cbor:"last_failure"`
+}
+
+func (h hostHealth) isDown() bool {
+	return h.LastFailure.After(h.LastSuccess) && time.Since(h.LastFailure) < mirrorFailureCooldown
+}
+
+// mirrorHealth remembers, across runs, which hosts have been failing and the mirror of
+// each repository index that worked last. It lives under CacheDir
+type mirrorHealth struct {
+	mu       sync.Mutex
+	path     string
+	Hosts    map[string]hostHealth `cbor:"hosts"`
+	LastGood map[string]string     `cbor:"last_good"`
+}
+
+var (
+	mirrors     *mirrorHealth
+	mirrorsOnce sync.Once
+)
+
+func loadMirrorHealth(config *Config) *mirrorHealth {
+	mirrorsOnce.Do(func() {
+		mirrors = &mirrorHealth{
+			path:     filepath.Join(config.CacheDir, ".index", "mirrors.cbor"),
+			Hosts:    make(map[string]hostHealth),
+			LastGood: make(map[string]string),
+		}
+		if data, err := os.ReadFile(mirrors.path); err == nil {
+			_ = cbor.Unmarshal(data, mirrors)
+		}
+	})
+	return mirrors
+}
+
+func mirrorHost(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return rawURL
+}
+
+// order sorts candidate URLs so that the last one known to work for key is tried first,
+// and the ones on hosts that are currently considered down are tried last
+func (m *mirrorHealth) order(key string, candidates []string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ordered := append([]string{}, candidates...)
+	lastGood := m.LastGood[key]
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if (ordered[i] == lastGood) != (ordered[j] == lastGood) {
+			return ordered[i] == lastGood
+		}
+		return !m.Hosts[mirrorHost(ordered[i])].isDown() && m.Hosts[mirrorHost(ordered[j])].isDown()
+	})
+	return ordered
+}
+
+// report records how fetching from candidate went. Only the failures of the host itself count
+// against it: not a missing file, a bad checksum or the user cancelling
+func (m *mirrorHealth) report(key, candidate string, err error) {
+	if err != nil && !isTransient(err) {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	host := mirrorHost(candidate)
+	health := m.Hosts[host]
+	if err != nil {
+		health.LastFailure = time.Now()
+	} else {
+		health.LastSuccess = time.Now()
+		if key != "" {
+			m.LastGood[key] = candidate
+		}
+	}
+	m.Hosts[host] = health
+}
+
+func (m *mirrorHealth) save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, err := cbor.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+		return err
+	}
+	tempFile := m.path + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tempFile, m.path)
+}
+
+// repoMirrors returns the URL of a repository index followed by its configured mirrors
+func repoMirrors(config *Config, repoURL string) []string {
+	return append([]string{repoURL}, config.Repos[repoURL].Mirrors...)
+}
+
+// downloadMirrors returns the URL of a binary followed by the same URL on every mirror
+// configured in DownloadMirrors for the prefix it starts with
+func downloadMirrors(config *Config, downloadURL string) []string {
+	candidates := []string{downloadURL}
+	for prefix, alternatives := range config.DownloadMirrors {
+		if !strings.HasPrefix(downloadURL, prefix) {
+			continue
+		}
+		for _, alternative := range alternatives {
+			candidates = append(candidates, alternative+strings.TrimPrefix(downloadURL, prefix))
+		}
+	}
+	return candidates
+}
+
+func joinMirrorErrors(errs []error) error {
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "all %d mirrors failed:", len(errs))
+	for _, err := range errs {
+		fmt.Fprintf(&sb, "\n    %v", err)
+	}
+	return fmt.Errorf("%s", sb.String())
+}
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/fxamacker/cbor/v2"
 	"github.com/goccy/go-json"
@@ -78,10 +83,24 @@ type DbinItem struct {
 	GhcrPkg         string   `json:"ghcr_pkg,omitempty"         `
 	GhcrBlob        string   `json:"ghcr_blob,omitempty"        `
 	Rank            uint     `json:"rank,omitempty"             `
+	SchemaVersion   uint     `json:"schema_version,omitempty"   `
 }
 
 type DbinMetadata map[string][]DbinItem
 
+// Version of the index schema we emit. Every item carries it, so that the files keep the
+// map[string][]DbinItem layout that older dbin releases decode
+const schemaVersion = 1
+
+func withSchemaVersion(metadata DbinMetadata) DbinMetadata {
+	for repo, items := range metadata {
+		for i := range items {
+			metadata[repo][i].SchemaVersion = schemaVersion
+		}
+	}
+	return metadata
+}
+
 type RepositoryHandler interface {
 	FetchMetadata(url string) ([]DbinItem, error)
 }
@@ -294,11 +313,10 @@ func saveMetadata(filename string, metadata DbinMetadata) error {
 	if err := saveAll(filename, metadata); err != nil {
 		return err
 	}
-	// "lite" version
+	// "lite" version. Provides is kept, dbin resolves names through it
 	for _, items := range metadata {
 		for i := range items {
 			items[i].Icon = ""
-			items[i].Provides = ""
 		}
 	}
 	filename += ".lite"
@@ -306,25 +324,25 @@ func saveMetadata(filename string, metadata DbinMetadata) error {
 }
 
 func saveCBOR(filename string, metadata DbinMetadata) error {
-	cborData, err := cbor.Marshal(metadata)
+	cborData, err := cbor.Marshal(withSchemaVersion(metadata))
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(filename+".cbor", cborData, 0644)
+	return writeSigned(filename+".cbor", cborData)
 }
 func saveYAML(filename string, metadata DbinMetadata) error {
-	yamlData, err := yaml.Marshal(metadata)
+	yamlData, err := yaml.Marshal(withSchemaVersion(metadata))
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(filename+".yaml", yamlData, 0644)
+	return writeSigned(filename+".yaml", yamlData)
 }
 func saveJSON(filename string, metadata DbinMetadata) error {
-	jsonData, err := json.MarshalIndent(metadata, "", " ")
+	jsonData, err := json.MarshalIndent(withSchemaVersion(metadata), "", " ")
 	if err != nil {
 		return err
 	}
-	if err := os.WriteFile(filename+".json", jsonData, 0644); err != nil {
+	if err := writeSigned(filename+".json", jsonData); err != nil {
 		return err
 	}
 	// Minify JSON
@@ -332,13 +350,93 @@ func saveJSON(filename string, metadata DbinMetadata) error {
 	m.AddFunc("application/json", mjson.Minify)
 	if jsonData, err = m.Bytes("application/json", jsonData); err != nil {
 		return err
-	} else if err := os.WriteFile(filename+".min.json", jsonData, 0644); err != nil {
+	} else if err := writeSigned(filename+".min.json", jsonData); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Signing key used to produce a detached minisign-style (legacy "Ed", non-prehashed) signature
+// next to every file we write. It is read from $DBIN_SIGNING_KEY as base64("Ed" || keyID[8] || seed[32])
+// and can be generated with `modMetadata genkey`. dbin verifies the signature over the uncompressed
+// file, so compressing the output afterwards does not invalidate it
+type signingKey struct {
+	keyID [8]byte
+	key   ed25519.PrivateKey
+}
+
+var signer *signingKey
+
+func loadSigningKey() (*signingKey, error) {
+	encoded := os.Getenv("DBIN_SIGNING_KEY")
+	if encoded == "" {
+		return nil, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(raw) != 2+8+ed25519.SeedSize || string(raw[:2]) != "Ed" {
+		return nil, fmt.Errorf("DBIN_SIGNING_KEY is not a valid signing key")
+	}
+	sk := &signingKey{key: ed25519.NewKeyFromSeed(raw[10:])}
+	copy(sk.keyID[:], raw[2:10])
+	return sk, nil
+}
+
+func (sk *signingKey) publicKey() string {
+	pub := append([]byte("Ed"), sk.keyID[:]...)
+	pub = append(pub, sk.key.Public().(ed25519.PublicKey)...)
+	return base64.StdEncoding.EncodeToString(pub)
+}
+
+func genKey() error {
+	seed := make([]byte, 2+8+ed25519.SeedSize)
+	copy(seed, "Ed")
+	if _, err := rand.Read(seed[2:]); err != nil {
 		return err
 	}
+	sk := &signingKey{key: ed25519.NewKeyFromSeed(seed[10:])}
+	copy(sk.keyID[:], seed[2:10])
+	fmt.Printf("DBIN_SIGNING_KEY=%s\n", base64.StdEncoding.EncodeToString(seed))
+	fmt.Printf("PubKey: %s\n", sk.publicKey())
 	return nil
 }
 
+func writeSigned(path string, data []byte) error {
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	if signer == nil {
+		return nil
+	}
+
+	sig := ed25519.Sign(signer.key, data)
+	trustedComment := fmt.Sprintf("timestamp:%d\tfile:%s", time.Now().Unix(), filepath.Base(path))
+	globalSig := ed25519.Sign(signer.key, append(append([]byte{}, sig...), trustedComment...))
+
+	sigBlob := append([]byte("Ed"), signer.keyID[:]...)
+	sigBlob = append(sigBlob, sig...)
+	minisig := fmt.Sprintf("untrusted comment: signature from dbin's modMetadata\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(sigBlob), trustedComment, base64.StdEncoding.EncodeToString(globalSig))
+	return os.WriteFile(path+".minisig", []byte(minisig), 0644)
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "genkey" {
+		if err := genKey(); err != nil {
+			fmt.Printf("Error generating signing key: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var err error
+	if signer, err = loadSigningKey(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if signer != nil {
+		fmt.Printf("Signing metadata with PubKey: %s\n", signer.publicKey())
+	}
+
 	realArchs := map[string]string{
 		"x86_64-Linux":  "amd64_linux",
 		"aarch64-Linux": "arm64_linux",
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/term"
+)
+
+// ambiguousBins returns the variants a bare name could be installed as, when they have more than
+// one pkg_id between them. Names that are pinned, installed or given with a pkg_id are not ambiguous
+func ambiguousBins(config *Config, bEntry binaryEntry, uRepoIndex *binaryIndex) []binaryEntry {
+	if bEntry.PkgId != "" || strings.Contains(bEntry.Name, "://") {
+		return nil
+	}
+	if _, pinned := config.PinnedVariants[bEntry.Name]; pinned {
+		return nil
+	}
+	if bEntryOfinstalledBinary(filepath.Join(config.InstallDir, bEntry.Name)).Name != "" {
+		return nil
+	}
+
+	var runnable []binaryEntry
+	pkgIds := make(map[string]bool)
+	for _, bin := range findMatchingBins(config, bEntry, uRepoIndex) {
+		if canRunVariant(config, bin) {
+			runnable = append(runnable, bin)
+			pkgIds[bin.PkgId] = true
+		}
+	}
+	return ternary(len(pkgIds) > 1, runnable, nil)
+}
+
+func printVariants(bins []binaryEntry, selected binaryEntry) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  #\tPKG_ID\tVERSION\tSIZE\tBUILD DATE\tREPO")
+	for i, bin := range bins {
+		fmt.Fprintf(w, "%s %d\t%s\t%s\t%s\t%s\t%s\n", ternary(bin.PkgId == selected.PkgId && bin.RepoName == selected.RepoName, "*", " "),
+			i+1, bin.PkgId, bin.Version, bin.Size, bin.BuildDate, bin.RepoName)
+	}
+	w.Flush()
+}
+
+// pickVariants resolves the names of bEntries that match several pkg_ids. With strict it fails
+// listing the candidates, on a terminal it asks which one to install and remembers the answer in
+// PinnedVariants, and otherwise it lets the VariantPolicy choose as usual
+func pickVariants(config *Config, bEntries []binaryEntry, uRepoIndex *binaryIndex, strict bool) ([]binaryEntry, error) {
+	interactive := term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+	if !strict && !interactive {
+		return bEntries, nil
+	}
+
+	var ambiguous []string
+	pins := make(map[string]string)
+	reader := bufio.NewReader(os.Stdin)
+	for i, bEntry := range bEntries {
+		bins := ambiguousBins(config, bEntry, uRepoIndex)
+		if len(bins) == 0 {
+			continue
+		}
+
+		if strict {
+			var candidates []string
+			for _, bin := range bins {
+				candidates = append(candidates, variantString(bin)+ternary(bin.Version != "", " ("+bin.Version+")", ""))
+			}
+			ambiguous = append(ambiguous, fmt.Sprintf("[%s] matches %d variants:\n    %s", bEntry.Name, len(bins), strings.Join(candidates, "\n    ")))
+			continue
+		}
+
+		selected, _ := selectVariant(config, bins)
+		defaultChoice := 1
+		for n, bin := range bins {
+			if bin.PkgId == selected.PkgId && bin.RepoName == selected.RepoName {
+				defaultChoice = n + 1
+			}
+		}
+
+		fmt.Printf("[%s] matches %d variants:\n", bEntry.Name, len(bins))
+		printVariants(bins, selected)
+		choice := 0
+		for choice < 1 || choice > len(bins) {
+			fmt.Printf("Install which one? [1-%d, default %d] ", len(bins), defaultChoice)
+			answer, err := reader.ReadString('\n')
+			if answer = strings.TrimSpace(answer); answer == "" || err != nil {
+				choice = defaultChoice
+			} else {
+				choice, _ = strconv.Atoi(answer)
+			}
+		}
+
+		bEntries[i].PkgId = bins[choice-1].PkgId
+		pins[bEntry.Name] = bins[choice-1].PkgId
+	}
+
+	if len(ambiguous) > 0 {
+		return nil, fmt.Errorf("refusing to guess in strict mode, pick a variant with name#pkg_id:\n  %s", strings.Join(ambiguous, "\n  "))
+	}
+
+	if len(pins) > 0 {
+		configFilePath, err := editConfigFile(func(cfg *Config) error {
+			if cfg.PinnedVariants == nil {
+				cfg.PinnedVariants = make(map[string]string)
+			}
+			for name, pkgId := range pins {
+				cfg.PinnedVariants[name] = pkgId
+			}
+			return nil
+		}, "PinnedVariants")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to remember the chosen variants: %v\n", err)
+		} else {
+			fmt.Printf("Remembered the chosen variants under PinnedVariants in %s\n", configFilePath)
+		}
+	}
+
+	return bEntries, nil
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/xattr"
+)
+
+// resolveProvidedNames replaces every requested name that is not a package, but is provided by
+// one, with the name of that package, so that `dbin install vi` installs the package providing vi.
+// Names provided by several packages are left alone, for findURL to report them
+func resolveProvidedNames(config *Config, bEntries []binaryEntry, verbosityLevel Verbosity, uRepoIndex *binaryIndex) []binaryEntry {
+	for i, bEntry := range bEntries {
+		if bEntry.Name == "" || strings.Contains(bEntry.Name, "://") || len(uRepoIndex.byName[bEntry.Name]) > 0 {
+			continue
+		}
+		if len(ambiguousProviders(config, bEntry, uRepoIndex)) > 0 {
+			continue
+		}
+
+		provider, _ := selectVariant(config, findMatchingBins(config, bEntry, uRepoIndex))
+		if provider.Name == "" {
+			continue
+		}
+		if verbosityLevel >= normalVerbosity {
+			fmt.Printf("[%s] is provided by [%s]\n", bEntry.Name, parseBinaryEntry(provider, false))
+		}
+		bEntries[i].Name = provider.Name
+		if bEntries[i].PkgId == "" {
+			bEntries[i].PkgId = provider.PkgId
+		}
+	}
+	return bEntries
+}
+
+// ambiguousProviders returns the names of the packages that provide the program bEntry names,
+// when it is not a package itself and more than one package provides it. A pkg_id, given or
+// picked, and PinnedVariants settle which one is meant
+func ambiguousProviders(config *Config, bEntry binaryEntry, uRepoIndex *binaryIndex) []string {
+	if bEntry.Name == "" || bEntry.PkgId != "" || len(uRepoIndex.byName[bEntry.Name]) > 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var providers []string
+	for _, bin := range findMatchingBins(config, bEntry, uRepoIndex) {
+		if canRunVariant(config, bin) && !seen[bin.Name] {
+			seen[bin.Name] = true
+			providers = append(providers, bin.Name)
+		}
+	}
+	sort.Strings(providers)
+	return ternary(len(providers) > 1, providers, nil)
+}
+
+func ambiguousProvidersError(bEntry binaryEntry, providers []string) error {
+	return fmt.Errorf("[%s] is provided by several packages (%s), name the one to use or pick one with `dbin install %s` on a terminal", bEntry.Name, strings.Join(providers, ", "), bEntry.Name)
+}
+
+// providedBins returns the programs listed in the "provides" of an entry. Those that are links to
+// its binary ("<binary>==<link>") are listed under the name of the link
+func providedBins(bin binaryEntry) []string {
+	var provided []string
+	for _, field := range strings.Split(bin.ExtraBins, ",") {
+		if _, link, ok := strings.Cut(field, "=="); ok {
+			field = link
+		} else if i := strings.IndexAny(field, "=:"); i >= 0 {
+			field = field[:i]
+		}
+		if field = strings.TrimSpace(field); field != "" {
+			provided = append(provided, field)
+		}
+	}
+	return provided
+}
+
+// providedLinks returns the programs that bin provides as links to its own binary, which its
+// "provides" marks as "<binary>==<link>", as multi-call binaries such as busybox do
+func providedLinks(bin binaryEntry) []string {
+	var links []string
+	for _, field := range strings.Split(bin.ExtraBins, ",") {
+		binary, link, ok := strings.Cut(strings.TrimSpace(field), "==")
+		if ok && strings.TrimSpace(binary) == filepath.Base(bin.Name) && strings.TrimSpace(link) != "" {
+			links = append(links, strings.TrimSpace(link))
+		}
+	}
+	return links
+}
+
+// providedPackages splits the programs that bin provides as executables of its own, rather than
+// as links, into the ones that the index has as packages of the same pkg_id and repository and
+// the ones it does not
+func providedPackages(config *Config, bin binaryEntry, uRepoIndex *binaryIndex) (available, unavailable []string) {
+	links := make(map[string]bool)
+	for _, link := range providedLinks(bin) {
+		links[link] = true
+	}
+	seen := make(map[string]bool)
+	for _, provided := range providedBins(bin) {
+		provided = filepath.Base(provided)
+		if provided == filepath.Base(bin.Name) || links[provided] || seen[provided] {
+			continue
+		}
+		seen[provided] = true
+		if len(findMatchingBins(config, binaryEntry{Name: provided, PkgId: bin.PkgId, RepoName: bin.RepoName}, uRepoIndex)) == 0 {
+			unavailable = append(unavailable, provided)
+		} else {
+			available = append(available, provided)
+		}
+	}
+	return available, unavailable
+}
+
+// addProvidedPackages adds the programs that the packages of bEntries provide as executables of
+// their own, rather than as links, to the binaries to install. Only the ones that the index has
+// as packages of the same pkg_id and repository can be, the rest are reported
+func addProvidedPackages(config *Config, bEntries []binaryEntry, verbosityLevel Verbosity, uRepoIndex *binaryIndex) []binaryEntry {
+	requested := make(map[string]bool)
+	for _, bEntry := range bEntries {
+		requested[bEntry.Name] = true
+	}
+
+	for _, bEntry := range bEntries {
+		if strings.Contains(bEntry.Name, "://") {
+			continue
+		}
+		bin, found := findBinaryInfo(config, trackedBEntry(config, bEntry), uRepoIndex)
+		if !found {
+			continue
+		}
+
+		available, unavailable := providedPackages(config, bin, uRepoIndex)
+		for _, provided := range available {
+			if requested[provided] {
+				continue
+			}
+			requested[provided] = true
+			if verbosityLevel >= normalVerbosity {
+				fmt.Printf("[%s] also provides [%s], which is installed along with it\n", bEntry.Name, provided)
+			}
+			bEntries = append(bEntries, binaryEntry{Name: provided, PkgId: bin.PkgId, RepoName: bin.RepoName})
+		}
+		if len(unavailable) > 0 && verbosityLevel >= normalVerbosity {
+			fmt.Fprintf(os.Stderr, "Warning: [%s] also provides %s, which no repository has on its own\n", bEntry.Name, strings.Join(unavailable, ", "))
+		}
+	}
+	return bEntries
+}
+
+// recordProvidedPackages records the packages that addProvidedPackages installs along with bin
+// in the xattrs of its binary, so that they can be removed along with it
+func recordProvidedPackages(config *Config, binaryPath string, bin binaryEntry, uRepoIndex *binaryIndex) error {
+	available, _ := providedPackages(config, bin, uRepoIndex)
+	if len(available) == 0 {
+		return nil
+	}
+	if err := xattr.Set(binaryPath, "user.ProvidedPackages", []byte(strings.Join(available, ","))); err != nil {
+		return fmt.Errorf("failed to set xattr for %s: %w", binaryPath, err)
+	}
+	return nil
+}
+
+// withProvidedPackages adds to bEntries the packages recorded by recordProvidedPackages for the
+// installed binaries they name, as long as those are still installed from the same pkg_id
+func withProvidedPackages(config *Config, bEntries []binaryEntry) []binaryEntry {
+	requested := make(map[string]bool)
+	for _, bEntry := range bEntries {
+		requested[filepath.Base(bEntry.Name)] = true
+	}
+
+	for _, bEntry := range bEntries {
+		binaryPath := filepath.Join(config.InstallDir, filepath.Base(bEntry.Name))
+		owner := bEntryOfinstalledBinary(binaryPath)
+		if owner.PkgId == "" {
+			continue
+		}
+		if filepath.Base(owner.Name) != filepath.Base(bEntry.Name) {
+			binaryPath = filepath.Join(config.InstallDir, filepath.Base(owner.Name))
+		}
+		provided, err := xattr.Get(binaryPath, "user.ProvidedPackages")
+		if err != nil || len(provided) == 0 {
+			continue
+		}
+		for _, name := range strings.Split(string(provided), ",") {
+			name = filepath.Base(name)
+			if requested[name] {
+				continue
+			}
+			if installed := bEntryOfinstalledBinary(filepath.Join(config.InstallDir, name)); installed.PkgId != owner.PkgId {
+				continue
+			}
+			requested[name] = true
+			bEntries = append(bEntries, binaryEntry{Name: name})
+		}
+	}
+	return bEntries
+}
+
+// linkProvidedBins creates a symlink to binaryPath for every program that bin provides as a link
+// to its own binary. The links are recorded in the binary's xattrs so that they can be removed
+// along with it. Existing files are never replaced
+func linkProvidedBins(binaryPath string, bin binaryEntry) error {
+	dir, target := filepath.Dir(binaryPath), filepath.Base(binaryPath)
+
+	var links, conflicts []string
+	for _, provided := range providedLinks(bin) {
+		provided = filepath.Base(provided)
+		if provided == target || provided == "." || provided == "/" {
+			continue
+		}
+		linkPath := filepath.Join(dir, provided)
+		if existing, err := os.Readlink(linkPath); err == nil && existing == target {
+			links = append(links, provided)
+			continue
+		}
+		if _, err := os.Lstat(linkPath); err == nil {
+			conflicts = append(conflicts, provided)
+			continue
+		}
+		if err := os.Symlink(target, linkPath); err != nil {
+			return fmt.Errorf("failed to link %s to %s: %v", linkPath, target, err)
+		}
+		links = append(links, provided)
+	}
+
+	if len(links) > 0 {
+		if err := xattr.Set(binaryPath, "user.ProvidedLinks", []byte(strings.Join(links, ","))); err != nil {
+			return fmt.Errorf("failed to set xattr for %s: %w", binaryPath, err)
+		}
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("did not link %s to %s: they already exist in %s", strings.Join(conflicts, ", "), target, dir)
+	}
+	return nil
+}
+
+// removeProvidedLinks removes the symlinks linkProvidedBins created for binaryPath, as long as
+// they still point to it
+func removeProvidedLinks(binaryPath string) error {
+	links, err := xattr.Get(binaryPath, "user.ProvidedLinks")
+	if err != nil || len(links) == 0 {
+		return nil
+	}
+
+	dir, target := filepath.Dir(binaryPath), filepath.Base(binaryPath)
+	for _, link := range strings.Split(string(links), ",") {
+		linkPath := filepath.Join(dir, filepath.Base(link))
+		if existing, err := os.Readlink(linkPath); err == nil && existing == target {
+			if err := os.Remove(linkPath); err != nil {
+				return fmt.Errorf("failed to remove %s: %v", linkPath, err)
+			}
+		}
+	}
+	return nil
+}
+
+// removeProvidedLink removes linkPath, if it is one of the symlinks that linkProvidedBins created,
+// and drops it from the links recorded for the binary it points to. It reports whether linkPath
+// was such a link
+func removeProvidedLink(linkPath string) (bool, error) {
+	target, err := os.Readlink(linkPath)
+	if err != nil || filepath.Base(target) != target {
+		return false, nil
+	}
+	binaryPath := filepath.Join(filepath.Dir(linkPath), target)
+	links, err := xattr.Get(binaryPath, "user.ProvidedLinks")
+	if err != nil {
+		return false, nil
+	}
+
+	var remaining []string
+	found := false
+	for _, link := range strings.Split(string(links), ",") {
+		if link == filepath.Base(linkPath) {
+			found = true
+		} else if link != "" {
+			remaining = append(remaining, link)
+		}
+	}
+	if !found {
+		return false, nil
+	}
+
+	if err := os.Remove(linkPath); err != nil {
+		return true, fmt.Errorf("failed to remove %s: %v", linkPath, err)
+	}
+	if len(remaining) == 0 {
+		err = xattr.Remove(binaryPath, "user.ProvidedLinks")
+	} else {
+		err = xattr.Set(binaryPath, "user.ProvidedLinks", []byte(strings.Join(remaining, ",")))
+	}
+	if err != nil {
+		return true, fmt.Errorf("failed to update the xattrs of %s: %w", binaryPath, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// reflink is only implemented on Linux, elsewhere plain copies are made instead
+func reflink(src, dst string) error {
+	return errors.ErrUnsupported
+}
@@ -17,30 +17,58 @@ func removeCommand() *cli.Command {
 		Aliases: []string{"del"},
 		Usage:   "Remove binaries",
 		Action: func(ctx context.Context, c *cli.Command) error {
-			config, err := loadConfig()
+			config, err := loadConfig(c)
 			if err != nil {
 				return err
 			}
-			uRepoIndex := fetchRepoIndex(config)
-			return removeBinaries(config, arrStringToArrBinaryEntry(c.Args().Slice()), getVerbosityLevel(c), uRepoIndex)
+			uRepoIndex, err := fetchRepoIndex(ctx, config)
+			if err != nil {
+				uRepoIndex = newBinaryIndex(nil)
+			}
+			args, err := expandGroups(config, c.Args().Slice())
+			if err != nil {
+				return err
+			}
+			return removeBinaries(config, arrStringToArrBinaryEntry(args), getVerbosityLevel(c), uRepoIndex)
 		},
 	}
 }
 
-func removeBinaries(config *Config, bEntries []binaryEntry, verbosityLevel Verbosity, uRepoIndex []binaryEntry) error {
+func removeBinaries(config *Config, bEntries []binaryEntry, verbosityLevel Verbosity, uRepoIndex *binaryIndex) error {
 	var wg sync.WaitGroup
 	var removeErrors []string
 	var mutex sync.Mutex
 
 	installDir := config.InstallDir
 
-	for _, bEntry := range bEntries {
+	for _, bEntry := range withProvidedPackages(config, bEntries) {
 		wg.Add(1)
 		go func(bEntry binaryEntry) {
 			defer wg.Done()
 
 			installPath := filepath.Join(installDir, filepath.Base(bEntry.Name))
 
+			// A link to a multi-call binary is removed on its own, the binary it points to stays
+			if isSymlink(installPath) {
+				removed, err := removeProvidedLink(installPath)
+				switch {
+				case err != nil:
+					if verbosityLevel >= silentVerbosityWithErrors {
+						fmt.Fprintf(os.Stderr, "error: %v\n", err)
+					}
+					mutex.Lock()
+					removeErrors = append(removeErrors, err.Error())
+					mutex.Unlock()
+				case !removed:
+					if verbosityLevel >= normalVerbosity {
+						fmt.Fprintf(os.Stderr, "Skipping '%s': it was not installed by dbin\n", bEntry.Name)
+					}
+				case verbosityLevel >= silentVerbosityWithErrors:
+					fmt.Printf("'%s' removed from %s\n", bEntry.Name, installDir)
+				}
+				return
+			}
+
 			trackedBEntry, err := readEmbeddedBEntry(installPath)
 			if err != nil {
 				if verbosityLevel >= normalVerbosity {
@@ -77,6 +105,10 @@ func removeBinaries(config *Config, bEntries []binaryEntry, verbosityLevel Verbo
 				return
 			}
 
+			if err := removeProvidedLinks(installPath); err != nil && verbosityLevel >= silentVerbosityWithErrors {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+
 			err = os.Remove(installPath)
 			if err != nil {
 				if verbosityLevel >= silentVerbosityWithErrors {
@@ -100,8 +132,8 @@ func removeBinaries(config *Config, bEntries []binaryEntry, verbosityLevel Verbo
 	return nil
 }
 
-func runDeintegrationHooks(config *Config, binaryPath string, verbosityLevel Verbosity, uRepoIndex []binaryEntry) error {
-	if config.UseIntegrationHooks {
+func runDeintegrationHooks(config *Config, binaryPath string, verbosityLevel Verbosity, uRepoIndex *binaryIndex) error {
+	if config.UseIntegrationHooks && !isCrossArch(config) {
 		ext := filepath.Ext(binaryPath)
 		if hookCommands, exists := config.Hooks.Commands[ext]; exists {
 			for _, cmd := range hookCommands.DeintegrationCommands {
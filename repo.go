@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+func repoCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "repo",
+		Usage: "Manage the repositories whose indexes dbin uses",
+		Commands: []*cli.Command{
+			{
+				Name:  "list",
+				Usage: "List the configured repositories",
+				Action: func(ctx context.Context, c *cli.Command) error {
+					config, err := loadConfig(c)
+					if err != nil {
+						return err
+					}
+					for i, url := range config.RepoURLs {
+						fmt.Printf("%d. [%s] %s\n", i+1, ternary(config.Repos[url].Disabled, "disabled", "enabled"), redactURL(url))
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "add",
+				Usage:     "Add a repository, after checking that its index can be fetched and decoded",
+				ArgsUsage: "<url>",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:  "mirror",
+						Usage: "URL of a mirror of the repository's index (can be repeated)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "pubkey",
+						Usage: "Public key trusted to sign the repository's index (can be repeated)",
+					},
+					&cli.StringFlag{
+						Name:  "sig-url",
+						Usage: "URL of the index's signature, if it is not the index URL followed by .minisig",
+					},
+					&cli.BoolFlag{
+						Name:  "allow-unsigned",
+						Usage: "Accept the repository's index even if it is not signed",
+					},
+				},
+				Action: func(ctx context.Context, c *cli.Command) error {
+					url := c.Args().First()
+					if url == "" {
+						return fmt.Errorf("no repository URL provided")
+					}
+					settings := RepoSettings{
+						Mirrors:       c.StringSlice("mirror"),
+						PubKeys:       c.StringSlice("pubkey"),
+						SigURL:        c.String("sig-url"),
+						AllowUnsigned: c.Bool("allow-unsigned"),
+					}
+					if len(settings.PubKeys) > 0 && settings.AllowUnsigned {
+						return fmt.Errorf("--allow-unsigned cannot be combined with --pubkey, the index of a repository with keys must be signed")
+					}
+					return editRepos(func(cfg *Config) error {
+						if repoPosition(cfg, url) >= 0 {
+							return fmt.Errorf("%s is already configured", redactURL(url))
+						}
+
+						config, err := loadConfig(c)
+						if err != nil {
+							return err
+						}
+						config.RefreshIndex = true
+						config.Repos = map[string]RepoSettings{url: settings}
+						if err := expandArch(config); err != nil {
+							return err
+						}
+						entries, err := decodeRepoIndex(ctx, config, expandRepoURL(config, url))
+						if err != nil {
+							return fmt.Errorf("not adding %s: %v", redactURL(url), err)
+						}
+						fmt.Printf("Fetched the index of %s: %d packages\n", redactURL(url), len(entries))
+
+						cfg.RepoURLs = append(cfg.RepoURLs, url)
+						cfg.Repos[url] = settings
+						return nil
+					})
+				},
+			},
+			{
+				Name:      "remove",
+				Aliases:   []string{"del"},
+				Usage:     "Remove a repository",
+				ArgsUsage: "<url|number>",
+				Action: func(ctx context.Context, c *cli.Command) error {
+					return editRepos(func(cfg *Config) error {
+						i, err := findRepo(cfg, c.Args().First())
+						if err != nil {
+							return err
+						}
+						delete(cfg.Repos, cfg.RepoURLs[i])
+						cfg.RepoURLs = append(cfg.RepoURLs[:i], cfg.RepoURLs[i+1:]...)
+						return nil
+					})
+				},
+			},
+			{
+				Name:      "enable",
+				Usage:     "Enable a repository",
+				ArgsUsage: "<url|number>",
+				Action: func(ctx context.Context, c *cli.Command) error {
+					return editRepos(func(cfg *Config) error {
+						return setRepoDisabled(cfg, c.Args().First(), false)
+					})
+				},
+			},
+			{
+				Name:      "disable",
+				Usage:     "Disable a repository without removing it",
+				ArgsUsage: "<url|number>",
+				Action: func(ctx context.Context, c *cli.Command) error {
+					return editRepos(func(cfg *Config) error {
+						return setRepoDisabled(cfg, c.Args().First(), true)
+					})
+				},
+			},
+			{
+				Name:      "show",
+				Usage:     "Show details about the configured repositories",
+				ArgsUsage: "[url|number]",
+				Action: func(ctx context.Context, c *cli.Command) error {
+					config, err := loadConfig(c)
+					if err != nil {
+						return err
+					}
+					repoURLs := config.RepoURLs
+					if c.Args().First() != "" {
+						i, err := findRepo(config, c.Args().First())
+						if err != nil {
+							return err
+						}
+						repoURLs = repoURLs[i : i+1]
+					}
+					for _, url := range repoURLs {
+						showRepo(ctx, config, url)
+					}
+					return nil
+				},
+			},
+			repoLintCommand(),
+		},
+	}
+}
+
+// repoPosition returns where url is in RepoURLs, or -1. URLs with {{arch}} in them can be given
+// either as written in the config file or as shown by `repo list`, with {{arch}} expanded
+func repoPosition(config *Config, url string) int {
+	for i, repoURL := range config.RepoURLs {
+		if repoURL == url || repoURL == expandRepoURL(config, url) || archTemplateMatches(repoURL, url) {
+			return i
+		}
+	}
+	return -1
+}
+
+// findRepo resolves either a repository URL or its 1-based position as shown by `repo list`
+func findRepo(config *Config, arg string) (int, error) {
+	if arg == "" {
+		return -1, fmt.Errorf("no repository provided")
+	}
+	if n, err := strconv.Atoi(arg); err == nil && n >= 1 && n <= len(config.RepoURLs) {
+		return n - 1, nil
+	}
+	if i := repoPosition(config, arg); i >= 0 {
+		return i, nil
+	}
+	return -1, fmt.Errorf("repository %s is not configured", redactURL(arg))
+}
+
+func setRepoDisabled(cfg *Config, arg string, disabled bool) error {
+	i, err := findRepo(cfg, arg)
+	if err != nil {
+		return err
+	}
+	settings := cfg.Repos[cfg.RepoURLs[i]]
+	settings.Disabled = disabled
+	cfg.Repos[cfg.RepoURLs[i]] = settings
+	return nil
+}
+
+// editRepos applies edit to the repositories as written in the config file and saves them
+func editRepos(edit func(cfg *Config) error) error {
+	configFilePath, err := editConfigFile(func(cfg *Config) error {
+		if cfg.Repos == nil {
+			cfg.Repos = make(map[string]RepoSettings)
+		}
+		return edit(cfg)
+	}, "RepoURLs", "Repos")
+	if err != nil {
+		return err
+	}
+
+	if _, overridden := os.LookupEnv("DBIN_REPO_URLS"); overridden {
+		fmt.Fprintf(os.Stderr, "Warning: DBIN_REPO_URLS is set and takes precedence over the RepoURLs in %s\n", configFilePath)
+	}
+	fmt.Printf("Updated the repositories in %s\n", configFilePath)
+	return nil
+}
+
+func showRepo(ctx context.Context, config *Config, url string) {
+	settings := config.Repos[url]
+	fmt.Printf("\033[48;5;4m%s\033[0m: %s\n", "Repository", redactURL(url))
+	fmt.Printf("  Status: %s\n", ternary(settings.Disabled, "disabled", "enabled"))
+	for _, mirror := range settings.Mirrors {
+		fmt.Printf("  Mirror: %s\n", redactURL(mirror))
+	}
+
+	var entries []binaryEntry
+	if _, isLocal := localRepoIndexPath(url); isLocal {
+		var err error
+		if entries, err = decodeRepoIndex(ctx, config, url); err != nil {
+			fmt.Printf("  Error: %v\n", err)
+			return
+		}
+		fmt.Printf("  Source: local file, read on every use\n")
+	} else {
+		cache, err := readRepoIndexCache(config, url)
+		if err != nil {
+			fmt.Printf("  Last fetched: never\n")
+			return
+		}
+		entries = cache.Entries
+		fmt.Printf("  Format: %s\n", ternary(cache.Format != "", cache.Format, "unknown"))
+		fmt.Printf("  Compression: %s\n", ternary(cache.Compression != "", cache.Compression, "unknown"))
+		fmt.Printf("  Schema version: %s\n", ternary(cache.SchemaVersion != 0, strconv.Itoa(cache.SchemaVersion), "none (legacy index)"))
+		fmt.Printf("  Signed by: %s\n", ternary(cache.SignedBy != "", cache.SignedBy, "nobody (unsigned)"))
+		if cache.FetchedFrom != "" && cache.FetchedFrom != url {
+			fmt.Printf("  Fetched from: %s\n", redactURL(cache.FetchedFrom))
+		}
+		fmt.Printf("  Last fetched: %s (%s ago)\n", cache.FetchedAt.Format(time.RFC3339), time.Since(cache.FetchedAt).Round(time.Second))
+	}
+
+	counts := make(map[string]int)
+	for _, entry := range entries {
+		counts[entry.RepoName]++
+	}
+	repoNames := make([]string, 0, len(counts))
+	for repoName := range counts {
+		repoNames = append(repoNames, repoName)
+	}
+	sort.Strings(repoNames)
+
+	var perRepo []string
+	for _, repoName := range repoNames {
+		perRepo = append(perRepo, fmt.Sprintf("%s: %d", repoName, counts[repoName]))
+	}
+	fmt.Printf("  Packages: %d (%s)\n", len(entries), strings.Join(perRepo, ", "))
+}
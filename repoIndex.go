@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+)
+
+// binaryIndex is the union of every repository index, with lookup tables so that resolving
+// a package or searching does not have to walk all of the entries each time
+type binaryIndex struct {
+	entries []binaryEntry
+	byName  map[string][]int
+	byPkgId map[string][]int
+	byBsum  map[string][]int
+	// entries by each of the programs in their "provides"
+	byProvides map[string][]int
+	// lowercase "name\x00pkg_id\x00description" of each entry, for fSearch
+	haystacks []string
+	// parsed Categories of each entry
+	categories [][]string
+}
+
+func newBinaryIndex(entries []binaryEntry) *binaryIndex {
+	idx := &binaryIndex{
+		entries:    entries,
+		byName:     make(map[string][]int, len(entries)),
+		byPkgId:    make(map[string][]int, len(entries)),
+		byBsum:     make(map[string][]int, len(entries)),
+		byProvides: make(map[string][]int),
+		haystacks:  make([]string, len(entries)),
+		categories: make([][]string, len(entries)),
+	}
+
+	for i, entry := range entries {
+		idx.byName[entry.Name] = append(idx.byName[entry.Name], i)
+		if entry.PkgId != "" {
+			idx.byPkgId[entry.PkgId] = append(idx.byPkgId[entry.PkgId], i)
+		}
+		if entry.Bsum != "" {
+			idx.byBsum[entry.Bsum] = append(idx.byBsum[entry.Bsum], i)
+		}
+		for _, provided := range providedBins(entry) {
+			idx.byProvides[provided] = append(idx.byProvides[provided], i)
+		}
+		idx.haystacks[i] = strings.ToLower(entry.Name + "\x00" + entry.PkgId + "\x00" + entry.Description)
+		idx.categories[i] = parseCategories(entry.Categories)
+	}
+
+	return idx
+}
+
+func (idx *binaryIndex) collect(positions []int) []binaryEntry {
+	entries := make([]binaryEntry, 0, len(positions))
+	for _, i := range positions {
+		entries = append(entries, idx.entries[i])
+	}
+	return entries
+}
+
+// candidates returns the entries that may match bEntry: those with its name, or those
+// with its pkg_id when only a pkg_id was given ("#pkg_id"), or else those that provide it
+func (idx *binaryIndex) candidates(bEntry binaryEntry) []binaryEntry {
+	if bEntry.Name == "" && bEntry.PkgId != "" {
+		return idx.collect(idx.byPkgId[bEntry.PkgId])
+	}
+	if positions, ok := idx.byName[bEntry.Name]; ok {
+		return idx.collect(positions)
+	}
+	return idx.providersOf(bEntry.Name)
+}
+
+func (idx *binaryIndex) providersOf(program string) []binaryEntry {
+	return idx.collect(idx.byProvides[program])
+}
+
+func (idx *binaryIndex) withBsum(bsum string) []binaryEntry {
+	return idx.collect(idx.byBsum[bsum])
+}
+
+// isListed reports whether the index still has the binary of bEntry with the given B3SUM, under
+// the same name and pkg_id (and repository, when it is known)
+func (idx *binaryIndex) isListed(bEntry binaryEntry, bsum string) bool {
+	for _, entry := range idx.withBsum(bsum) {
+		if entry.Name == bEntry.Name && entry.PkgId == bEntry.PkgId && (bEntry.RepoName == "" || entry.RepoName == bEntry.RepoName) {
+			return true
+		}
+	}
+	return false
+}
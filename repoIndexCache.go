@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/zeebo/blake3"
+)
+
+// repoIndexCache is the decoded form of a repository index as stored under CacheDir,
+// along with the validators needed to revalidate it against the remote copy
+type repoIndexCache struct {
+	URL           string        `cbor:"url"`
+	FetchedFrom   string        `cbor:"fetched_from,omitempty"`
+	ETag          string        `cbor:"etag,omitempty"`
+	LastModified  string        `cbor:"last_modified,omitempty"`
+	FetchedAt     time.Time     `cbor:"fetched_at"`
+	SignedBy      string        `cbor:"signed_by,omitempty"`
+	Format        string        `cbor:"format,omitempty"`
+	Compression   string        `cbor:"compression,omitempty"`
+	SchemaVersion int           `cbor:"schema_version,omitempty"`
+	Entries       []binaryEntry `cbor:"entries"`
+}
+
+func repoIndexCachePath(config *Config, url string) string {
+	sum := blake3.Sum256([]byte(url))
+	return filepath.Join(config.CacheDir, ".index", hex.EncodeToString(sum[:8])+".cbor")
+}
+
+func (cache *repoIndexCache) isFresh(config *Config) bool {
+	maxAge := time.Duration(config.IndexCacheMaxAge) * time.Second
+	return maxAge > 0 && time.Since(cache.FetchedAt) < maxAge
+}
+
+func readRepoIndexCache(config *Config, url string) (*repoIndexCache, error) {
+	data, err := os.ReadFile(repoIndexCachePath(config, url))
+	if err != nil {
+		return nil, err
+	}
+
+	var cache repoIndexCache
+	if err := cbor.Unmarshal(data, &cache); err != nil {
+		return nil, fmt.Errorf("error decoding cached index of %s: %v", redactURL(url), err)
+	}
+	if cache.URL != url {
+		return nil, fmt.Errorf("cached index belongs to %s, not %s", redactURL(cache.URL), redactURL(url))
+	}
+	return &cache, nil
+}
+
+func writeRepoIndexCache(config *Config, cache *repoIndexCache) error {
+	cachePath := repoIndexCachePath(config, cache.URL)
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return fmt.Errorf("failed to create index cache directory: %v", err)
+	}
+
+	data, err := cbor.Marshal(cache)
+	if err != nil {
+		return fmt.Errorf("error encoding index of %s: %v", redactURL(cache.URL), err)
+	}
+
+	tempFile := cachePath + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tempFile, cachePath); err != nil {
+		_ = os.Remove(tempFile)
+		return err
+	}
+	return nil
+}
@@ -22,4 +22,8 @@ type binaryEntry struct {
 	Notes       []string `json:"notes,omitempty"       `
 	SrcURLs     []string `json:"src_urls,omitempty"    `
 	WebURLs     []string `json:"web_urls,omitempty"    `
+	Schema      uint16   `json:"schema_version,omitempty"`
+	RepoName    string   `json:"-" cbor:"repo_name,omitempty"`
+	RepoURL     string   `json:"-" cbor:"repo_url,omitempty" `
+	Snapshot    string   `json:"-" cbor:"-"`
 }
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+
+	"github.com/urfave/cli/v3"
+)
+
+// An index is a map of repository names to their entries. Entries of indexes that follow a
+// versioned schema carry its version in their schema_version field, which dbin releases that
+// predate it ignore; indexes without it are treated as legacy indexes
+const repoIndexSchemaVersion = 1
+
+var (
+	checksumRegex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+	sizeRegex     = regexp.MustCompile(`(?i)^[0-9]+(\.[0-9]+)? ?([KMGT]i?)?B?$`)
+)
+
+// repoIndexProblem is something wrong with an entry of an index. Position is the 1-based
+// position of the entry within the list of its repository. Entries with problems that are
+// only warnings can still be used
+type repoIndexProblem struct {
+	RepoName string
+	Position int
+	Entry    string
+	Problem  string
+	Warning  bool
+}
+
+func (p repoIndexProblem) String() string {
+	return fmt.Sprintf("%s%s[%d] (%s): %s", ternary(p.Warning, "warning: ", ""), p.RepoName, p.Position, p.Entry, p.Problem)
+}
+
+// validateRepoIndex checks every entry of an index and returns the ones that can be used,
+// along with all of the problems that were found. Only entries that cannot be told apart or
+// fetched are left out, a missing checksum or a malformed size is only warned about
+func validateRepoIndex(entries []binaryEntry) ([]binaryEntry, []repoIndexProblem) {
+	var problems []repoIndexProblem
+	valid := make([]binaryEntry, 0, len(entries))
+	positions := make(map[string]int)
+	seen := make(map[string]int)
+
+	for _, entry := range entries {
+		positions[entry.RepoName]++
+		position := positions[entry.RepoName]
+
+		var errs, warnings []string
+		if entry.Name == "" {
+			errs = append(errs, "missing pkg")
+		}
+		if entry.PkgId == "" {
+			errs = append(errs, "missing pkg_id")
+		}
+		if entry.DownloadURL == "" && entry.GhcrPkg == "" {
+			errs = append(errs, "neither download_url nor ghcr_pkg is set")
+		}
+		if entry.Name != "" && entry.PkgId != "" {
+			key := entry.RepoName + "\x00" + entry.Name + "\x00" + entry.PkgId
+			if first, ok := seen[key]; ok {
+				errs = append(errs, fmt.Sprintf("duplicate of %s[%d]", entry.RepoName, first))
+			} else {
+				seen[key] = position
+			}
+		}
+		if entry.Bsum == "" && entry.Shasum == "" {
+			warnings = append(warnings, "neither bsum nor shasum is set, it cannot be verified")
+		}
+		if entry.Bsum != "" && !checksumRegex.MatchString(entry.Bsum) {
+			warnings = append(warnings, fmt.Sprintf("malformed bsum %q, expected a hex encoded BLAKE3 sum", entry.Bsum))
+		}
+		if entry.Shasum != "" && !checksumRegex.MatchString(entry.Shasum) {
+			warnings = append(warnings, fmt.Sprintf("malformed shasum %q, expected a hex encoded SHA-256 sum", entry.Shasum))
+		}
+		if entry.Size != "" && !sizeRegex.MatchString(entry.Size) {
+			warnings = append(warnings, fmt.Sprintf("malformed size %q", entry.Size))
+		}
+
+		for i, problem := range append(errs, warnings...) {
+			problems = append(problems, repoIndexProblem{
+				RepoName: entry.RepoName,
+				Position: position,
+				Entry:    parseBinaryEntry(entry, false),
+				Problem:  problem,
+				Warning:  i >= len(errs),
+			})
+		}
+		if len(errs) == 0 {
+			valid = append(valid, entry)
+		}
+	}
+
+	return valid, problems
+}
+
+func repoLintCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "lint",
+		Usage:     "Check a repository index for problems before publishing it",
+		ArgsUsage: "<url|file>",
+		Action: func(ctx context.Context, c *cli.Command) error {
+			config, err := loadConfig(c)
+			if err != nil {
+				return err
+			}
+			source := c.Args().First()
+			if source == "" {
+				return fmt.Errorf("no repository index provided")
+			}
+			return lintRepoIndex(ctx, config, source)
+		},
+	}
+}
+
+func lintRepoIndex(ctx context.Context, config *Config, source string) error {
+	data, contentType, err := readRepoIndexSource(ctx, config, source)
+	if err != nil {
+		return err
+	}
+	data, compression, err := decompressRepoIndex(source, data)
+	if err != nil {
+		return err
+	}
+	format := detectRepoIndexFormat(source, contentType, data)
+	entries, schemaVersion, err := parseRepoIndex(source, format, data)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Format: %s, compression: %s\n", format, compression)
+	if schemaVersion == 0 {
+		fmt.Println("Warning: no entry has a schema_version, the index will be treated as a legacy index")
+	} else {
+		fmt.Printf("Schema version: %d\n", schemaVersion)
+	}
+
+	valid, problems := validateRepoIndex(entries)
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	invalid := len(entries) - len(valid)
+	fmt.Printf("%d entries, %d invalid, %d problems\n", len(entries), invalid, len(problems))
+	if invalid > 0 {
+		return fmt.Errorf("%s has %d entries that dbin would ignore", redactURL(source), invalid)
+	}
+	return nil
+}
+
+// readRepoIndexSource reads an index as-is, bypassing the cache and the mirrors
+func readRepoIndexSource(ctx context.Context, config *Config, source string) ([]byte, string, error) {
+	if path, isLocal := localRepoIndexPath(source); isLocal {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("error opening local repository index %s: %v", path, err)
+		}
+		return data, "", nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", source, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("error creating request for %s: %v", redactURL(source), err)
+	}
+	req.Header.Set("Cache-Control", "no-cache")
+	if err := authorizeRequest(config, req); err != nil {
+		return nil, "", err
+	}
+
+	client, err := httpClient(config)
+	if err != nil {
+		return nil, "", err
+	}
+	response, err := client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("error fetching from %s: %v", redactURL(source), err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("error fetching from %s: unexpected status %s", redactURL(source), response.Status)
+	}
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading from %s: %v", redactURL(source), err)
+	}
+	return data, response.Header.Get("Content-Type"), nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// partialDownload describes the .tmp file an interrupted download leaves behind. It is kept next
+// to it, so that the next attempt at the same URL can ask only for the bytes that are missing
+type partialDownload struct {
+	URL          string `cbor:"url"`
+	Bsum         string `cbor:"bsum,omitempty"`
+	ETag         string `cbor:"etag,omitempty"`
+	LastModified string `cbor:"last_modified,omitempty"`
+}
+
+func partialDownloadPath(tempFile string) string {
+	return tempFile + ".resume"
+}
+
+func hasChecksum(checksum string) bool {
+	return checksum != "" && checksum != "!no_check"
+}
+
+// validator returns what If-Range can be set to for the server to only resume the download if
+// the file has not changed since. Weak ETags cannot be used for that
+func (p partialDownload) validator() string {
+	if p.ETag != "" && !strings.HasPrefix(p.ETag, "W/") {
+		return p.ETag
+	}
+	return p.LastModified
+}
+
+// resumeDownload asks for the rest of the partial download of req's URL that was interrupted
+// while fetching destination, if there is one. Without a validator to send in If-Range the file
+// may have changed in between, so it is only resumed when the checksum can tell
+func resumeDownload(req *http.Request, destination, checksum string) {
+	tempFile := destination + ".tmp"
+	info, err := os.Stat(tempFile)
+	if err != nil || info.Size() == 0 {
+		return
+	}
+	data, err := os.ReadFile(partialDownloadPath(tempFile))
+	if err != nil {
+		return
+	}
+	var partial partialDownload
+	if err := cbor.Unmarshal(data, &partial); err != nil || partial.URL != req.URL.String() || partial.Bsum != checksum {
+		return
+	}
+	if partial.validator() == "" && !hasChecksum(checksum) {
+		return
+	}
+
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", info.Size()))
+	if validator := partial.validator(); validator != "" {
+		req.Header.Set("If-Range", validator)
+	}
+}
+
+// savePartialDownload records where the download in resp comes from, as long as it could be
+// resumed if it is interrupted
+func savePartialDownload(resp *http.Response, tempFile, checksum string) {
+	partial := partialDownload{
+		URL:          originalURL(resp),
+		Bsum:         checksum,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	if resp.Header.Get("Accept-Ranges") == "none" || partial.validator() == "" && !hasChecksum(checksum) {
+		_ = os.Remove(partialDownloadPath(tempFile))
+		return
+	}
+	if data, err := cbor.Marshal(partial); err == nil {
+		_ = os.WriteFile(partialDownloadPath(tempFile), data, 0644)
+	}
+}
+
+// keepPartialDownload leaves an interrupted download in place for the next attempt to resume it,
+// unless there is no record of it that would allow that
+func keepPartialDownload(tempFile string) {
+	if !fileExists(partialDownloadPath(tempFile)) {
+		_ = os.Remove(tempFile)
+	}
+}
+
+// discardPartialDownload removes the .tmp file of a download along with its record
+func discardPartialDownload(tempFile string) {
+	_ = os.Remove(tempFile)
+	_ = os.Remove(partialDownloadPath(tempFile))
+}
+
+// originalURL returns the URL that was requested to get resp, before any redirects were followed
+func originalURL(resp *http.Response) string {
+	req := resp.Request
+	for req.Response != nil && req.Response.Request != nil {
+		req = req.Response.Request
+	}
+	return req.URL.String()
+}
+
+// openPartialDownload opens the .tmp file the body of resp is to be written to. When the server
+// resumed a previous download the file is kept, and what it already holds is fed to prefix so that
+// the checksum covers the whole file, otherwise it is truncated. It returns how much was kept
+func openPartialDownload(resp *http.Response, tempFile string, prefix io.Writer) (*os.File, int64, error) {
+	if resp.StatusCode != http.StatusPartialContent {
+		out, err := os.Create(tempFile)
+		return out, 0, err
+	}
+
+	out, err := os.OpenFile(tempFile, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset, err := io.Copy(prefix, out)
+	if err != nil {
+		out.Close()
+		return nil, 0, fmt.Errorf("failed to read the partial download %s: %v", tempFile, err)
+	}
+
+	// Content-Range: bytes <start>-<end>/<size>
+	start, _, _ := strings.Cut(strings.TrimPrefix(resp.Header.Get("Content-Range"), "bytes "), "-")
+	if n, err := strconv.ParseInt(start, 10, 64); err != nil || n != offset {
+		out.Close()
+		return nil, 0, fmt.Errorf("the server resumed the download of %s at byte %s instead of %d", tempFile, start, offset)
+	}
+	return out, offset, nil
+}
+
+// checkDownloadStatus fails unless resp carries the file or the rest of it. A range the server
+// cannot satisfy means the partial download is of no use, so it is dropped for the next attempt
+func checkDownloadStatus(resp *http.Response, url, destination string) error {
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+		return nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		discardPartialDownload(destination + ".tmp")
+	}
+	return newHTTPStatusError(resp, url)
+}
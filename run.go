@@ -28,18 +28,22 @@ func runCommand() *cli.Command {
 				return fmt.Errorf("no binary name provided for run command")
 			}
 
-			config, err := loadConfig()
+			config, err := loadConfig(c)
 			if err != nil {
 				return err
 			}
 			
 			bEntry := stringToBinaryEntry(c.Args().First())
-			return runFromCache(config, bEntry, c.Args().Tail(), c.Bool("transparent"), getVerbosityLevel(c))
+			return runFromCache(ctx, config, bEntry, c.Args().Tail(), c.Bool("transparent"), getVerbosityLevel(c))
 		},
 	}
 }
 
-func runFromCache(config *Config, bEntry binaryEntry, args []string, transparentMode bool, verbosityLevel Verbosity) error {
+func runFromCache(ctx context.Context, config *Config, bEntry binaryEntry, args []string, transparentMode bool, verbosityLevel Verbosity) error {
+	if isCrossArch(config) {
+		return fmt.Errorf("cannot run %s: binaries for %s do not run on %s", bEntry.Name, targetArch(config), hostArch())
+	}
+
 	// Try running from PATH if transparent mode is enabled
 	if transparentMode {
 		binaryPath, err := exec.LookPath(bEntry.Name)
@@ -66,11 +70,17 @@ func runFromCache(config *Config, bEntry binaryEntry, args []string, transparent
 			}
 			return cleanCache(config.CacheDir, verbosityLevel)
 		}
-		
+
+		if config.Offline {
+			return fmt.Errorf("cached binary '%s' does not match requested binary '%s' and dbin is in offline mode",
+				parseBinaryEntry(trackedBEntry, false), parseBinaryEntry(bEntry, false))
+		}
 		if verbosityLevel >= normalVerbosity {
 			fmt.Printf("Cached binary '%s' does not match requested binary '%s'. Fetching a new one...\n", 
 				parseBinaryEntry(trackedBEntry, false), parseBinaryEntry(bEntry, false))
 		}
+	} else if config.Offline {
+		return fmt.Errorf("couldn't find '%s' in the cache and dbin is in offline mode", bEntry.Name)
 	} else if verbosityLevel >= normalVerbosity {
 		fmt.Printf("Couldn't find '%s' in the cache. Fetching a new one...\n", bEntry.Name)
 	}
@@ -80,8 +90,11 @@ func runFromCache(config *Config, bEntry binaryEntry, args []string, transparent
 	cacheConfig.UseIntegrationHooks = false
 	cacheConfig.InstallDir = config.CacheDir
 	
-	uRepoIndex := fetchRepoIndex(&cacheConfig)
-	if err := installBinaries(context.Background(), &cacheConfig, []binaryEntry{bEntry}, silentVerbosityWithErrors, uRepoIndex); err != nil {
+	uRepoIndex, err := fetchRepoIndex(ctx, &cacheConfig)
+	if err != nil {
+		return err
+	}
+	if err := installBinaries(ctx, &cacheConfig, []binaryEntry{bEntry}, silentVerbosityWithErrors, uRepoIndex); err != nil {
 		return err
 	}
 
@@ -12,45 +12,56 @@ import (
 func searchCommand() *cli.Command {
 	return &cli.Command{
 		Name:  "search",
-		Usage: "Search for a binary by supplying one or more search terms",
+		Usage: "Search for a binary by supplying one or more search terms, category:<c> narrows the results down to a category",
 		Action: func(ctx context.Context, c *cli.Command) error {
-			config, err := loadConfig()
+			config, err := loadConfig(c)
+			if err != nil {
+				return err
+			}
+			uRepoIndex, err := fetchRepoIndex(ctx, config)
 			if err != nil {
 				return err
 			}
-			uRepoIndex := fetchRepoIndex(config)
 			return fSearch(config, c.Args().Slice(), uRepoIndex)
 		},
 	}
 }
 
-func fSearch(config *Config, searchTerms []string, uRepoIndex []binaryEntry) error {
+func fSearch(config *Config, searchTerms []string, uRepoIndex *binaryIndex) error {
 	var results []binaryEntry
 
-	for _, bin := range uRepoIndex {
-		name, pkgId, version, description, rank := bin.Name, bin.PkgId, bin.Version, bin.Description, bin.Rank
+	terms, categories := splitCategoryFilters(searchTerms)
+	lowerTerms := make([]string, len(terms))
+	for i, term := range terms {
+		lowerTerms[i] = strings.ToLower(term)
+	}
 
-		if name == "" || description == "" {
+	for i, bin := range uRepoIndex.entries {
+		if bin.Name == "" || bin.Description == "" {
 			continue
 		}
 
 		match := true
-		for _, term := range searchTerms {
-			if !strings.Contains(strings.ToLower(name), strings.ToLower(term)) &&
-				!strings.Contains(strings.ToLower(description), strings.ToLower(term)) &&
-				!strings.Contains(strings.ToLower(pkgId), strings.ToLower(term)) {
+		for _, term := range lowerTerms {
+			if !strings.Contains(uRepoIndex.haystacks[i], term) {
 				match = false
 				break
 			}
 		}
+		for _, category := range categories {
+			if match && !uRepoIndex.inCategory(i, category) {
+				match = false
+			}
+		}
 
 		if match {
 			results = append(results, binaryEntry{
-				Name:        name,
-				PkgId:       pkgId,
-				Version:     version,
-				Description: description,
-				Rank:        rank,
+				Name:        bin.Name,
+				PkgId:       bin.PkgId,
+				Version:     bin.Version,
+				Description: bin.Description,
+				Rank:        bin.Rank,
+				RepoName:    bin.RepoName,
 			})
 		}
 	}
@@ -71,8 +82,8 @@ func fSearch(config *Config, searchTerms []string, uRepoIndex []binaryEntry) err
 			prefix = "[i]"
 		}
 
-		truncatePrintf(disableTruncation, "%s %s - %s\n",
-			prefix, parseBinaryEntry(result, true), result.Description)
+		truncatePrintf(disableTruncation, "%s %s%s - %s\n",
+			prefix, parseBinaryEntry(result, true), ternary(result.RepoName != "", "\033[90m@"+result.RepoName+"\033[0m", ""), result.Description)
 	}
 
 	return nil
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Repository indexes are signed the way minisign does it with the legacy (non-prehashed) "Ed" algorithm:
+// the public key is base64("Ed" || keyID[8] || ed25519 key[32]) and the detached .minisig file holds
+// an untrusted comment, base64("Ed" || keyID[8] || signature[64]), a trusted comment and the global
+// signature over signature || trusted comment. Signatures cover the decompressed index
+const (
+	minisignAlgorithm       = "Ed"
+	minisignPrehashedAlg    = "ED"
+	minisignSignatureSuffix = ".minisig"
+	minisignTrustedPrefix   = "trusted comment: "
+)
+
+type minisignPublicKey struct {
+	KeyID [8]byte
+	Key   ed25519.PublicKey
+}
+
+func (k minisignPublicKey) id() string {
+	return strings.ToUpper(hex.EncodeToString(k.KeyID[:]))
+}
+
+// parseMinisignPublicKey accepts either the base64 line alone or the whole contents of a .pub file
+func parseMinisignPublicKey(s string) (minisignPublicKey, error) {
+	var pk minisignPublicKey
+
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[len(lines)-1]))
+	if err != nil {
+		return pk, fmt.Errorf("invalid public key encoding: %v", err)
+	}
+	if len(raw) != 2+8+ed25519.PublicKeySize || string(raw[:2]) != minisignAlgorithm {
+		return pk, fmt.Errorf("invalid public key: not an Ed25519 minisign key")
+	}
+
+	copy(pk.KeyID[:], raw[2:10])
+	pk.Key = ed25519.PublicKey(raw[10:])
+	return pk, nil
+}
+
+// verifyMinisignSignature checks sigFile against message and returns the ID of the key that made it
+func verifyMinisignSignature(keys []minisignPublicKey, sigFile, message []byte) (string, error) {
+	lines := strings.Split(strings.TrimSpace(string(sigFile)), "\n")
+	if len(lines) < 4 || !strings.HasPrefix(lines[2], minisignTrustedPrefix) {
+		return "", fmt.Errorf("malformed signature file")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(sig) != 2+8+ed25519.SignatureSize {
+		return "", fmt.Errorf("malformed signature")
+	}
+	switch string(sig[:2]) {
+	case minisignAlgorithm:
+	case minisignPrehashedAlg:
+		return "", fmt.Errorf("prehashed signatures are not supported, sign the index with `minisign -S -l`")
+	default:
+		return "", fmt.Errorf("unknown signature algorithm %q", sig[:2])
+	}
+
+	globalSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return "", fmt.Errorf("malformed global signature")
+	}
+
+	for _, key := range keys {
+		if !bytes.Equal(key.KeyID[:], sig[2:10]) {
+			continue
+		}
+		if !ed25519.Verify(key.Key, message, sig[10:]) {
+			return "", fmt.Errorf("signature verification failed for key %s", key.id())
+		}
+		trustedComment := strings.TrimPrefix(strings.TrimRight(lines[2], "\r"), minisignTrustedPrefix)
+		signedComment := append(append([]byte{}, sig[10:]...), trustedComment...)
+		if !ed25519.Verify(key.Key, signedComment, globalSig) {
+			return "", fmt.Errorf("trusted comment verification failed for key %s", key.id())
+		}
+		return key.id(), nil
+	}
+
+	return "", fmt.Errorf("signed with key %s, which is not trusted for this repository", strings.ToUpper(hex.EncodeToString(sig[2:10])))
+}
+
+func repoIndexSignatureURL(url string, settings RepoSettings) string {
+	if settings.SigURL != "" {
+		return settings.SigURL
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(url, ".gz"), ".zst") + minisignSignatureSuffix
+}
+
+func repoTrustedKeys(config *Config, url string) ([]minisignPublicKey, error) {
+	var keys []minisignPublicKey
+	for _, s := range config.Repos[url].PubKeys {
+		key, err := parseMinisignPublicKey(s)
+		if err != nil {
+			return nil, fmt.Errorf("bad public key configured for %s: %v", redactURL(url), err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// unsignedRepoAllowed reports whether the index of the repository at url may be used unsigned,
+// which is only ever the case for repositories without PubKeys
+func unsignedRepoAllowed(config *Config, url string) bool {
+	return len(config.Repos[url].PubKeys) == 0 && (config.AllowUnsignedRepos || config.Repos[url].AllowUnsigned)
+}
+
+// repoIndexCacheTrusted reports whether an index cached earlier may still be used with the current keys
+func repoIndexCacheTrusted(config *Config, url string, cache *repoIndexCache) bool {
+	if cache.SignedBy == "" {
+		return unsignedRepoAllowed(config, url)
+	}
+	keys, err := repoTrustedKeys(config, url)
+	if err != nil {
+		return false
+	}
+	for _, key := range keys {
+		if key.id() == cache.SignedBy {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRepoIndexSignature verifies a decompressed index, obtained from source, against the keys trusted
+// for the repository at url and returns the ID of the key that signed it, or an empty string if it was accepted unsigned
+func checkRepoIndexSignature(ctx context.Context, config *Config, url, source string, data []byte) (string, error) {
+	keys, err := repoTrustedKeys(config, url)
+	if err != nil {
+		return "", err
+	}
+	if len(keys) == 0 {
+		if unsignedRepoAllowed(config, url) {
+			return "", nil
+		}
+		return "", fmt.Errorf("no trusted public keys are configured for %s. Add them to its PubKeys or set AllowUnsigned", redactURL(url))
+	}
+
+	// Once keys are configured the index must be signed, whatever AllowUnsigned says, or blocking
+	// the signature would be enough to have an index that was tampered with accepted
+	sigFile, err := fetchRepoIndexSignature(ctx, config, repoIndexSignatureURL(source, config.Repos[url]))
+	if err != nil {
+		return "", fmt.Errorf("index of %s is not signed: %v", redactURL(url), err)
+	}
+
+	keyID, err := verifyMinisignSignature(keys, sigFile, data)
+	if err != nil {
+		return "", fmt.Errorf("index of %s has a bad signature: %v", redactURL(url), err)
+	}
+	return keyID, nil
+}
+
+func fetchRepoIndexSignature(ctx context.Context, config *Config, sigURL string) ([]byte, error) {
+	if path, isLocal := localRepoIndexPath(sigURL); isLocal {
+		return os.ReadFile(path)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", sigURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Cache-Control", "no-cache")
+	if err := authorizeRequest(config, req); err != nil {
+		return nil, err
+	}
+
+	client, err := httpClient(config)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: unexpected status %s", redactURL(sigURL), resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 4096))
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+func versionsCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "versions",
+		Usage:     "List the snapshots a binary can be installed from, with their dates",
+		ArgsUsage: "<name[#pkg_id][@repo]>",
+		Action: func(ctx context.Context, c *cli.Command) error {
+			if c.Args().Len() != 1 {
+				return fmt.Errorf("versions takes exactly one binary")
+			}
+			config, err := loadConfig(c)
+			if err != nil {
+				return err
+			}
+			uRepoIndex, err := fetchRepoIndex(ctx, config)
+			if err != nil {
+				return err
+			}
+
+			bEntry := stringToBinaryEntry(c.Args().First())
+			bEntry.Version, bEntry.Snapshot = "", ""
+			bins := findMatchingBins(config, trackedBEntry(config, bEntry), uRepoIndex)
+			if len(bins) == 0 {
+				return fmt.Errorf("%s", notFoundMessage(bEntry, uRepoIndex))
+			}
+
+			for i, bin := range bins {
+				if i > 0 {
+					fmt.Println()
+				}
+				printSnapshots(ctx, config, bin)
+			}
+			return nil
+		},
+	}
+}
+
+// printSnapshots lists the build of bin in the index followed by each of its snapshots. The index
+// carries no dates for snapshots, so they are read from the creation date of their OCI manifest
+func printSnapshots(ctx context.Context, config *Config, bin binaryEntry) {
+	fmt.Printf("%s:\n", variantString(bin))
+	if len(bin.Snapshots) == 0 || !strings.HasPrefix(bin.GhcrPkg, "oci://") {
+		fmt.Printf("  %s (%s) has no snapshots\n", ternary(bin.Version != "", bin.Version, "unknown version"), ternary(bin.BuildDate != "", bin.BuildDate, "unknown date"))
+		return
+	}
+
+	dates := snapshotDates(ctx, config, bin)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  TAG\tVERSION\tDATE")
+	fmt.Fprintf(w, "  %s\t%s\t%s\t(current)\n", "latest", bin.Version, ternary(bin.BuildDate != "", bin.BuildDate, "unknown"))
+	for _, snapshot := range bin.Snapshots {
+		tag, version := parseSnapshot(snapshot)
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", tag, version, ternary(dates[tag] != "", dates[tag], "unknown"))
+	}
+	w.Flush()
+	fmt.Printf("Install one with `dbin install %s@snapshot:<tag>`\n", variantString(bin))
+}
+
+// snapshotDates returns the creation date of the manifest of each snapshot of bin, by tag.
+// Snapshots whose manifest cannot be fetched, or that is not dated, are left out
+func snapshotDates(ctx context.Context, config *Config, bin binaryEntry) map[string]string {
+	dates := make(map[string]string)
+	if config.Offline {
+		return dates
+	}
+
+	image := strings.TrimPrefix(bin.GhcrPkg, "oci://")
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	registry, repository := parseImage(image)
+
+	client, err := httpClient(config)
+	if err != nil {
+		return dates
+	}
+	token, err := getAuthToken(ctx, config, client, registry, repository)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to get the dates of the snapshots of %s: %v\n", bin.Name, err)
+		return dates
+	}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	for _, snapshot := range bin.Snapshots {
+		tag, _ := parseSnapshot(snapshot)
+		wg.Add(1)
+		go func(tag string) {
+			defer wg.Done()
+			manifest, err := downloadManifest(ctx, client, registry, repository, tag, token)
+			if err != nil {
+				return
+			}
+			if date := manifestCreated(manifest); date != "" {
+				mutex.Lock()
+				dates[tag] = date
+				mutex.Unlock()
+			}
+		}(tag)
+	}
+	wg.Wait()
+	return dates
+}
+
+// manifestCreated returns the org.opencontainers.image.created annotation of an OCI manifest
+func manifestCreated(manifest map[string]interface{}) string {
+	annotations, _ := manifest["annotations"].(map[string]interface{})
+	created, _ := annotations["org.opencontainers.image.created"].(string)
+	if t, err := time.Parse(time.RFC3339, created); err == nil {
+		return t.UTC().Format("2006-01-02 15:04")
+	}
+	return created
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+// The store keeps a copy of every binary dbin has fetched and verified, named after its checksum
+// (StoreDir/blake3/ab/abcdef...), so that installing it again, rolling back to it or running it
+// needs no download. Once it outgrows StoreMaxSize, the binaries used the longest ago are dropped.
+// Installed binaries are copies of the ones in the store, which take no extra space only where
+// the filesystem supports reflinks; elsewhere the store doubles it, which is why it can be disabled.
+// storeMu keeps the store from being pruned while binaries are read from or added to it
+var storeMu sync.RWMutex
+
+// storePath returns where the binary with checksum is kept in the store, or "" when there is no
+// checksum to name it after
+func storePath(config *Config, checksum string) string {
+	if config.StoreDir == "" || config.DisableStore || !hasChecksum(checksum) {
+		return ""
+	}
+	algorithm, sum := "blake3", strings.ToLower(checksum)
+	if s, ok := strings.CutPrefix(sum, sha256ChecksumPrefix); ok {
+		algorithm, sum = "sha256", s
+	}
+	if _, err := hex.DecodeString(sum); err != nil || len(sum) < 2 {
+		return ""
+	}
+	return filepath.Join(config.StoreDir, algorithm, sum[:2], sum)
+}
+
+// fetchBinaryFromStore puts the binary with checksum at destination, if it is in the store. The
+// copy in the store is checked first, and dropped if it no longer matches its checksum
+func fetchBinaryFromStore(config *Config, checksum, destination string) (string, error) {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+
+	storeFile := storePath(config, checksum)
+	if storeFile == "" || !fileExists(storeFile) {
+		return "", fmt.Errorf("%s is not in the store", filepath.Base(destination))
+	}
+	if !fileMatchesChecksum(storeFile, checksum) {
+		_ = os.Remove(storeFile)
+		return "", fmt.Errorf("the copy of %s in the store was corrupted, it has been removed", filepath.Base(destination))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return "", fmt.Errorf("failed to create parent directories for %s: %v", destination, err)
+	}
+	discardPartialDownload(destination + ".tmp")
+	if err := materializeFile(storeFile, destination); err != nil {
+		return "", fmt.Errorf("failed to get %s from the store: %v", filepath.Base(destination), err)
+	}
+	// Its modification time tells pruneStore when it was last used
+	now := time.Now()
+	_ = os.Chtimes(storeFile, now, now)
+	return destination, os.Chmod(destination, 0755)
+}
+
+// addToStore keeps a copy of the binary at path in the store. Binaries that were changed after
+// being verified (e.g to remove their Nix store paths) no longer match their checksum, and are
+// left out, which is why it is checked again
+func addToStore(config *Config, path, checksum string) error {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+
+	storeFile := storePath(config, checksum)
+	if storeFile == "" || fileExists(storeFile) || !fileMatchesChecksum(path, checksum) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(storeFile), 0755); err != nil {
+		return fmt.Errorf("failed to create the store directory %s: %v", filepath.Dir(storeFile), err)
+	}
+	if err := materializeFile(path, storeFile); err != nil {
+		return fmt.Errorf("failed to add %s to the store: %v", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// trimStore prunes the store down to StoreMaxSize, if it has a limit. It is called once the
+// binaries of an install have all been added, rather than after each of them
+func trimStore(config *Config) error {
+	if config.StoreMaxSize <= 0 || config.DisableStore {
+		return nil
+	}
+	if _, _, err := pruneStore(config, int64(config.StoreMaxSize)<<20); err != nil {
+		return fmt.Errorf("failed to keep the store under %d MiB: %v", config.StoreMaxSize, err)
+	}
+	return nil
+}
+
+// materializeFile makes dst a copy of src, which takes no extra space where the filesystem
+// supports reflinks. Hardlinks are not used, as the xattrs dbin sets on installed binaries would
+// end up on the copy in the store too. dst is replaced at once, never left half written
+func materializeFile(src, dst string) error {
+	tempFile := dst + ".tmp"
+	_ = os.Remove(tempFile)
+
+	if reflink(src, tempFile) == nil {
+		if err := os.Rename(tempFile, dst); err != nil {
+			_ = os.Remove(tempFile)
+			return err
+		}
+		return nil
+	}
+	return copyFile(src, dst)
+}
+
+type storeEntry struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// storeEntries lists the binaries in the store, along with how much space they take in total.
+// Files and directories that disappear while it walks the store are left out
+func storeEntries(config *Config) ([]storeEntry, int64, error) {
+	var entries []storeEntry
+	var total int64
+	err := filepath.WalkDir(config.StoreDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return ternary(d == nil || d.IsDir(), filepath.SkipDir, nil)
+			}
+			return err
+		}
+		if !d.Type().IsRegular() || strings.HasSuffix(path, ".tmp") {
+			return nil
+		}
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		entries = append(entries, storeEntry{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	return entries, total, err
+}
+
+// pruneStore removes the binaries used the longest ago from the store until it takes no more
+// than maxSize bytes. Nothing depends on them, installed binaries are copies. It returns how many
+// binaries were removed and how many bytes that freed
+func pruneStore(config *Config, maxSize int64) (int, int64, error) {
+	if config.StoreDir == "" {
+		return 0, 0, nil
+	}
+	storeMu.Lock()
+	defer storeMu.Unlock()
+
+	entries, total, err := storeEntries(config)
+	if err != nil {
+		return 0, 0, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].modTime.Before(entries[j].modTime) })
+
+	removed, freed := 0, int64(0)
+	for _, entry := range entries {
+		if total-freed <= maxSize {
+			break
+		}
+		if err := os.Remove(entry.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return removed, freed, err
+		}
+		removed++
+		freed += entry.size
+	}
+	return removed, freed, nil
+}
+
+func storeCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "store",
+		Usage: "Show how much space the store of verified binaries takes, or clean it",
+		Action: func(ctx context.Context, c *cli.Command) error {
+			config, err := loadConfig(c)
+			if err != nil {
+				return err
+			}
+			if config.StoreDir == "" || config.DisableStore {
+				return fmt.Errorf("the store is disabled, StoreDir is empty or DisableStore is set")
+			}
+			entries, total, err := storeEntries(config)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%d binaries, %.1f MiB in %s (limit: %s)\n", len(entries), float64(total)/(1<<20), config.StoreDir,
+				ternary(config.StoreMaxSize > 0, fmt.Sprintf("%d MiB", config.StoreMaxSize), "none"))
+			return nil
+		},
+		Commands: []*cli.Command{
+			{
+				Name:  "clean",
+				Usage: "Remove the binaries in the store, the ones used the longest ago first",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "max-size",
+						Usage: "Only remove binaries until the store takes no more than this many MiB",
+					},
+				},
+				Action: func(ctx context.Context, c *cli.Command) error {
+					config, err := loadConfig(c)
+					if err != nil {
+						return err
+					}
+					removed, freed, err := pruneStore(config, int64(c.Int("max-size"))<<20)
+					if err != nil {
+						return fmt.Errorf("failed to clean the store: %v", err)
+					}
+					fmt.Printf("Removed %d binaries from the store, freeing %.1f MiB\n", removed, float64(freed)/(1<<20))
+					return nil
+				},
+			},
+		},
+	}
+}
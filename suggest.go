@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const (
+	maxSuggestions     = 3
+	minSuggestionScore = 0.5
+)
+
+type suggestion struct {
+	name  string
+	score float64
+}
+
+// levenshtein returns the number of single rune insertions, deletions and substitutions that turn a into b
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := ternary(ra[i-1] == rb[j-1], 0, 1)
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// similarity scores how close candidate is to what the user typed, from the edit distance between
+// them plus a bonus when one is a prefix, or failing that a substring, of the other
+func similarity(query, candidate string) float64 {
+	score := 1 - float64(levenshtein(query, candidate))/float64(max(len([]rune(query)), len([]rune(candidate))))
+	switch {
+	case strings.HasPrefix(candidate, query) || strings.HasPrefix(query, candidate):
+		score += 0.3
+	case len(candidate) > 1 && (strings.Contains(candidate, query) || strings.Contains(query, candidate)):
+		score += 0.2
+	}
+	return score
+}
+
+// suggestBinaries returns the names of the packages closest to name, comparing it against
+// every name, pkg_id and provided program in the index
+func suggestBinaries(uRepoIndex *binaryIndex, name string) []string {
+	query := strings.ToLower(name)
+	best := make(map[string]float64)
+	consider := func(key, suggestedName string) {
+		key = strings.ToLower(key)
+		if key == "" || suggestedName == "" {
+			return
+		}
+		score := similarity(query, key)
+		if base := filepath.Base(key); base != key {
+			score = max(score, similarity(query, base))
+		}
+		if score >= minSuggestionScore && score > best[suggestedName] {
+			best[suggestedName] = score
+		}
+	}
+
+	for _, bin := range uRepoIndex.entries {
+		consider(bin.Name, bin.Name)
+		consider(bin.PkgId, bin.Name)
+		for _, provided := range providedBins(bin) {
+			consider(provided, bin.Name)
+		}
+	}
+	delete(best, name)
+
+	suggestions := make([]suggestion, 0, len(best))
+	for suggestedName, score := range best {
+		suggestions = append(suggestions, suggestion{suggestedName, score})
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].score != suggestions[j].score {
+			return suggestions[i].score > suggestions[j].score
+		}
+		return suggestions[i].name < suggestions[j].name
+	})
+
+	var names []string
+	for i := 0; i < len(suggestions) && i < maxSuggestions; i++ {
+		names = append(names, suggestions[i].name)
+	}
+	return names
+}
+
+// notFoundMessage tells that bEntry could not be found, and which packages may have been meant instead
+func notFoundMessage(bEntry binaryEntry, uRepoIndex *binaryIndex) string {
+	msg := fmt.Sprintf("didn't find download URL for [%s]", parseBinaryEntry(bEntry, false)+ternary(bEntry.Version != "", ":"+bEntry.Version, "")+ternary(bEntry.Snapshot != "", "@snapshot:"+bEntry.Snapshot, ""))
+	if len(uRepoIndex.candidates(bEntry)) > 0 {
+		if bEntry.Snapshot != "" {
+			msg += fmt.Sprintf(", see `dbin versions %s` for its snapshots", parseBinaryEntry(bEntry, false))
+		}
+		return msg
+	}
+	if suggestions := suggestBinaries(uRepoIndex, bEntry.Name); len(suggestions) > 0 {
+		msg += fmt.Sprintf(", did you mean %s?", strings.Join(suggestions, ", "))
+	}
+	return msg
+}
+
+// correctTypos offers to replace every requested name that is not in the index with its closest
+// match. It needs a terminal to ask on; without one the names are left as they are
+func correctTypos(config *Config, bEntries []binaryEntry, uRepoIndex *binaryIndex) []binaryEntry {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return bEntries
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for i, bEntry := range bEntries {
+		if strings.Contains(bEntry.Name, "://") || len(uRepoIndex.candidates(bEntry)) > 0 || bEntryOfinstalledBinary(filepath.Join(config.InstallDir, bEntry.Name)).Name != "" {
+			continue
+		}
+		suggestions := suggestBinaries(uRepoIndex, bEntry.Name)
+		if len(suggestions) == 0 {
+			continue
+		}
+
+		fmt.Printf("[%s] was not found, install [%s] instead? [y/N] ", bEntry.Name, suggestions[0])
+		answer, _ := reader.ReadString('\n')
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer == "y" || answer == "yes" {
+			bEntries[i].Name = suggestions[0]
+			bEntries[i].PkgId = ""
+		}
+	}
+	return bEntries
+}
@@ -16,17 +16,24 @@ func updateCommand() *cli.Command {
 		Name:  "update",
 		Usage: "Update binaries, by checking their b3sum[:256] against the repo's",
 		Action: func(ctx context.Context, c *cli.Command) error {
-			config, err := loadConfig()
+			config, err := loadConfig(c)
 			if err != nil {
 				return err
 			}
-			uRepoIndex := fetchRepoIndex(config)
-			return update(config, arrStringToArrBinaryEntry(c.Args().Slice()), getVerbosityLevel(c), uRepoIndex)
+			uRepoIndex, err := fetchRepoIndex(ctx, config)
+			if err != nil {
+				return err
+			}
+			args, err := expandGroups(config, c.Args().Slice())
+			if err != nil {
+				return err
+			}
+			return update(ctx, config, arrStringToArrBinaryEntry(args), getVerbosityLevel(c), uRepoIndex)
 		},
 	}
 }
 
-func update(config *Config, programsToUpdate []binaryEntry, verbosityLevel Verbosity, uRepoIndex []binaryEntry) error {
+func update(ctx context.Context, config *Config, programsToUpdate []binaryEntry, verbosityLevel Verbosity, uRepoIndex *binaryIndex) error {
 	var (
 		skipped, updated, errors uint32
 		checked                  uint32
@@ -71,6 +78,17 @@ func update(config *Config, programsToUpdate []binaryEntry, verbosityLevel Verbo
 				return
 			}
 
+			if trackedBEntry.Snapshot != "" {
+				progressMutex.Lock()
+				atomic.AddUint32(&checked, 1)
+				atomic.AddUint32(&skipped, 1)
+				if verbosityLevel >= normalVerbosity {
+					truncatePrintf(false, "\033[2K\r<%d/%d> %s | Skipping %s because it was installed from snapshot %s. Install it again to return to the latest build.", atomic.LoadUint32(&checked), toBeChecked, padding, parseBinaryEntry(trackedBEntry, false), trackedBEntry.Snapshot)
+				}
+				progressMutex.Unlock()
+				return
+			}
+
 			localB3sum, err := calculateChecksum(installPath)
 			if err != nil {
 				progressMutex.Lock()
@@ -83,6 +101,17 @@ func update(config *Config, programsToUpdate []binaryEntry, verbosityLevel Verbo
 				return
 			}
 
+			// A binary the index still lists needs no update, nor resolving its variant again
+			if uRepoIndex.isListed(trackedBEntry, localB3sum) {
+				progressMutex.Lock()
+				atomic.AddUint32(&checked, 1)
+				if verbosityLevel >= normalVerbosity {
+					truncatePrintf(false, "\033[2K\r<%d/%d> %s | No updates available for %s.", atomic.LoadUint32(&checked), toBeChecked, padding, parseBinaryEntry(trackedBEntry, false))
+				}
+				progressMutex.Unlock()
+				return
+			}
+
 			binInfo, err := getBinaryInfo(config, program, uRepoIndex)
 			if err != nil {
 				progressMutex.Lock()
@@ -132,7 +161,7 @@ func update(config *Config, programsToUpdate []binaryEntry, verbosityLevel Verbo
 
 	if len(outdatedPrograms) > 0 {
 		fmt.Print("\033[2K\r")
-		if err := installBinaries(context.Background(), config, outdatedPrograms, 1, uRepoIndex); err != nil {
+		if err := installBinaries(ctx, config, outdatedPrograms, 1, uRepoIndex); err != nil {
 			atomic.AddUint32(&errors, 1)
 			if verbosityLevel >= silentVerbosityWithErrors {
 				fmt.Printf("Failed to update programs: %v\n", outdatedPrograms)
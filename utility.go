@@ -2,13 +2,17 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/fxamacker/cbor/v2"
 	"github.com/goccy/go-json"
@@ -35,20 +39,45 @@ func isExecutable(filePath string) bool {
 	return info.Mode().IsRegular() && (info.Mode().Perm()&0o111) != 0
 }
 
+// stringToBinaryEntry parses "name#pkg_id:version@repo", where every part but the name is optional
+// and the version may be a constraint such as ">=1.7" or "~1.7". URLs are kept whole as the name
 func stringToBinaryEntry(input string) binaryEntry {
 	var bEntry binaryEntry
 
+	if strings.Contains(input, "://") {
+		// A checksum can be pinned in the fragment of a URL: https://example.org/tool#b3=<hex> or #sha256=<hex>
+		if i := strings.LastIndex(input, "#"); i > 0 {
+			algorithm, sum, _ := strings.Cut(input[i+1:], "=")
+			switch algorithm {
+			case "b3", "blake3":
+				bEntry.Bsum, input = sum, input[:i]
+			case "sha256":
+				bEntry.Shasum, input = sum, input[:i]
+			}
+		}
+		bEntry.Name = input
+		return bEntry
+	}
+
+	if i := strings.LastIndex(input, "@snapshot:"); i > 0 {
+		bEntry.Snapshot = input[i+len("@snapshot:"):]
+		input = input[:i]
+	}
+
+	if i := strings.LastIndex(input, "@"); i > 0 && !strings.ContainsAny(input[i+1:], "/:") {
+		bEntry.RepoName = input[i+1:]
+		input = input[:i]
+	}
+
+	if i := strings.Index(input, ":"); i >= 0 {
+		bEntry.Version = input[i+1:]
+		input = input[:i]
+	}
+
 	parts := strings.SplitN(input, "#", 2)
 	bEntry.Name = parts[0]
-
 	if len(parts) > 1 {
-		idVer := strings.SplitN(parts[1], ":", 2)
-		bEntry.PkgId = idVer[0]
-		if len(idVer) > 1 {
-			bEntry.Version = idVer[1]
-		}
-	} else {
-		bEntry.Name = input
+		bEntry.PkgId = parts[1]
 	}
 
 	return bEntry
@@ -88,12 +117,7 @@ func binaryEntriesToArrString(entries []binaryEntry, ansi bool) []string {
 	return result
 }
 
-func validateProgramsFrom(config *Config, programsToValidate []binaryEntry, uRepoIndex []binaryEntry) ([]binaryEntry, error) {
-	programsEntries, err := listBinaries(uRepoIndex)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list remote binaries: %w", err)
-	}
-
+func validateProgramsFrom(config *Config, programsToValidate []binaryEntry, uRepoIndex *binaryIndex) ([]binaryEntry, error) {
 	files, err := listFilesInDir(config.InstallDir)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list files in %s: %w", config.InstallDir, err)
@@ -109,8 +133,11 @@ func validateProgramsFrom(config *Config, programsToValidate []binaryEntry, uRep
 				trackedBEntry.PkgId = "!retake"
 			}
 		}
-		for _, remoteEntry := range programsEntries {
-			if remoteEntry.Name == trackedBEntry.Name && (remoteEntry.PkgId == trackedBEntry.PkgId || trackedBEntry.PkgId == "!retake") {
+		if trackedBEntry.Name == "" {
+			return binaryEntry{}, false
+		}
+		for _, remoteEntry := range uRepoIndex.candidates(trackedBEntry) {
+			if remoteEntry.PkgId == trackedBEntry.PkgId || trackedBEntry.PkgId == "!retake" {
 				return trackedBEntry, true
 			}
 		}
@@ -230,7 +257,8 @@ func listFilesInDir(dir string) ([]string, error) {
 
 func embedBEntry(binaryPath string, bEntry binaryEntry) error {
 	bEntry.Version = ""
-	if err := xattr.Set(binaryPath, "user.FullName", []byte(parseBinaryEntry(bEntry, false))); err != nil {
+	fullName := parseBinaryEntry(bEntry, false) + ternary(bEntry.RepoName != "", "@"+bEntry.RepoName, "") + ternary(bEntry.Snapshot != "", "@snapshot:"+bEntry.Snapshot, "")
+	if err := xattr.Set(binaryPath, "user.FullName", []byte(fullName)); err != nil {
 		return fmt.Errorf("failed to set xattr for %s: %w", binaryPath, err)
 	}
 	return nil
@@ -280,74 +308,290 @@ func removeNixGarbageFoundInTheRepos(filePath string) error {
 	return nil
 }
 
-func decodeRepoIndex(url string) ([]binaryEntry, error) {
+func decodeRepoIndex(ctx context.Context, config *Config, url string) ([]binaryEntry, error) {
 	if url == "" {
 		return nil, fmt.Errorf("repository index URL is empty. Please check your configuration or remove it")
 	}
 
-	req, err := http.NewRequest("GET", url, nil)
+	if path, isLocal := localRepoIndexPath(url); isLocal {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error opening local repository index %s: %v", path, err)
+		}
+		binaryEntries, _, err := decodeRepoIndexData(ctx, config, url, url, "", data)
+		return binaryEntries, err
+	}
+
+	cache, _ := readRepoIndexCache(config, url)
+	if cache != nil && !repoIndexCacheTrusted(config, url, cache) {
+		cache = nil
+	}
+	if config.Offline {
+		if cache == nil {
+			return nil, fmt.Errorf("no trusted cached index of %s is available while in offline mode", redactURL(url))
+		}
+		return cache.Entries, nil
+	}
+	if cache != nil && !config.RefreshIndex && cache.isFresh(config) {
+		return cache.Entries, nil
+	}
+
+	health := loadMirrorHealth(config)
+	var errs []error
+	for _, mirror := range health.order(url, repoMirrors(config, url)) {
+		binaryEntries, err := fetchRepoIndexFromMirror(ctx, config, url, mirror, cache)
+		health.report(url, mirror, err)
+		if err == nil {
+			return binaryEntries, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, joinMirrorErrors(errs)
+}
+
+// fetchRepoIndexFromMirror fetches the index of the repository at url from one of its mirrors,
+// revalidating the cached copy when it was obtained from that same mirror
+func fetchRepoIndexFromMirror(ctx context.Context, config *Config, url, mirror string, cache *repoIndexCache) ([]binaryEntry, error) {
+	if path, isLocal := localRepoIndexPath(mirror); isLocal {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error opening local repository index %s: %v", path, err)
+		}
+		binaryEntries, _, err := decodeRepoIndexData(ctx, config, url, mirror, "", data)
+		return binaryEntries, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", mirror, nil)
 	if err != nil {
-		return nil, fmt.Errorf("error creating request for %s: %v", url, err)
+		return nil, fmt.Errorf("error creating request for %s: %v", redactURL(mirror), err)
+	}
+	if err := authorizeRequest(config, req); err != nil {
+		return nil, err
 	}
 
-	req.Header.Set("Cache-Control", "no-cache, no-store, must-revalidate")
-	req.Header.Set("Pragma", "no-cache")
+	req.Header.Set("Cache-Control", "no-cache")
+	if cache != nil && !config.RefreshIndex && cache.FetchedFrom == mirror {
+		if cache.ETag != "" {
+			req.Header.Set("If-None-Match", cache.ETag)
+		}
+		if cache.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cache.LastModified)
+		}
+	}
 
-	client := &http.Client{}
+	client, err := httpClient(config)
+	if err != nil {
+		return nil, err
+	}
 	response, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("error fetching from %s: %v. Please check your configuration's repo_urls. Ensure your network has access to the internet", url, err)
+		return nil, fmt.Errorf("error fetching from %s: %w. Please check your configuration's repo_urls. Ensure your network has access to the internet", redactURL(mirror), err)
 	}
 	defer response.Body.Close()
-	bodyReader := response.Body
 
-	if strings.HasSuffix(url, ".gz") {
-		url = strings.TrimSuffix(url, ".gz")
-		bodyReader, err = gzip.NewReader(bodyReader)
-		if err != nil {
-			return nil, fmt.Errorf("error creating gzip reader for %s: %v", url, err)
+	if response.StatusCode == http.StatusNotModified && cache != nil {
+		cache.FetchedAt = time.Now()
+		if err := writeRepoIndexCache(config, cache); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to update the cached index of %s: %v\n", redactURL(url), err)
 		}
-		defer bodyReader.Close()
+		return cache.Entries, nil
 	}
-	if strings.HasSuffix(url, ".zst") {
-		url = strings.TrimSuffix(url, ".zst")
-		zstdReader, err := zstd.NewReader(bodyReader)
-		if err != nil {
-			return nil, fmt.Errorf("error creating zstd reader for %s: %v", url, err)
-		}
-		defer zstdReader.Close()
-		bodyReader = zstdReader.IOReadCloser()
+	if response.StatusCode != http.StatusOK {
+		return nil, newHTTPStatusError(response, mirror)
 	}
 
-	body := new(bytes.Buffer)
-	if _, err := io.Copy(body, bodyReader); err != nil {
-		return nil, fmt.Errorf("error reading from %s: %v", url, err)
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading from %s: %w", redactURL(mirror), err)
+	}
+	binaryEntries, meta, err := decodeRepoIndexData(ctx, config, url, mirror, response.Header.Get("Content-Type"), data)
+	if err != nil {
+		return nil, err
 	}
 
-	var repoIndex map[string][]binaryEntry
+	cache = &repoIndexCache{
+		URL:           url,
+		FetchedFrom:   mirror,
+		ETag:          response.Header.Get("ETag"),
+		LastModified:  response.Header.Get("Last-Modified"),
+		FetchedAt:     time.Now(),
+		SignedBy:      meta.SignedBy,
+		Format:        meta.Format,
+		Compression:   meta.Compression,
+		SchemaVersion: meta.SchemaVersion,
+		Entries:       binaryEntries,
+	}
+	if err := writeRepoIndexCache(config, cache); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to cache the index of %s: %v\n", redactURL(url), err)
+	}
+
+	return binaryEntries, nil
+}
+
+var (
+	gzipMagic             = []byte{0x1f, 0x8b}
+	zstdMagic             = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	cborSelfDescribeMagic = []byte{0xd9, 0xd9, 0xf7}
+)
+
+// localRepoIndexPath reports whether a repository source refers to the local filesystem,
+// either through a file:// URL or as a plain path, and returns that path
+func localRepoIndexPath(source string) (string, bool) {
+	if strings.HasPrefix(source, "file://") {
+		return strings.TrimPrefix(source, "file://"), true
+	}
+	return source, !strings.Contains(source, "://")
+}
+
+// repoIndexMeta describes how an index was stored and who signed it
+type repoIndexMeta struct {
+	Format        string
+	Compression   string
+	SignedBy      string
+	SchemaVersion int
+}
+
+// decodeRepoIndexData decompresses the raw index of the repository at url, as obtained from source
+// (the URL itself or one of its mirrors), checks its signature and decodes it
+func decodeRepoIndexData(ctx context.Context, config *Config, url, source, contentType string, data []byte) ([]binaryEntry, repoIndexMeta, error) {
+	var meta repoIndexMeta
+
+	data, compression, err := decompressRepoIndex(source, data)
+	if err != nil {
+		return nil, meta, err
+	}
+	meta.Compression = compression
+
+	if meta.SignedBy, err = checkRepoIndexSignature(ctx, config, url, source, data); err != nil {
+		return nil, meta, err
+	}
+
+	meta.Format = detectRepoIndexFormat(source, contentType, data)
+	binaryEntries, schemaVersion, err := parseRepoIndex(source, meta.Format, data)
+	if err != nil {
+		return nil, meta, err
+	}
+	meta.SchemaVersion = schemaVersion
+
+	validEntries, _ := validateRepoIndex(binaryEntries)
+	if invalid := len(binaryEntries) - len(validEntries); invalid > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: ignored %d invalid entries of %s, run `dbin repo lint %s` for details\n", invalid, redactURL(source), redactURL(source))
+	}
+	binaryEntries = validEntries
+	for i := range binaryEntries {
+		binaryEntries[i].RepoURL = url
+	}
+	return binaryEntries, meta, nil
+}
+
+func decompressRepoIndex(source string, body []byte) ([]byte, string, error) {
 	switch {
-	case strings.HasSuffix(url, ".cbor"):
-		if err := cbor.Unmarshal(body.Bytes(), &repoIndex); err != nil {
-			return nil, fmt.Errorf("error decoding CBOR from %s: %v", url, err)
+	case bytes.HasPrefix(body, gzipMagic):
+		gzipReader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, "", fmt.Errorf("error creating gzip reader for %s: %v", redactURL(source), err)
+		}
+		defer gzipReader.Close()
+		if body, err = io.ReadAll(gzipReader); err != nil {
+			return nil, "", fmt.Errorf("error decompressing gzip data from %s: %v", redactURL(source), err)
 		}
-	case strings.HasSuffix(url, ".json"):
-		if err := json.Unmarshal(body.Bytes(), &repoIndex); err != nil {
-			return nil, fmt.Errorf("error decoding JSON from %s: %v", url, err)
+		return body, "gzip", nil
+	case bytes.HasPrefix(body, zstdMagic):
+		zstdDecoder, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, "", fmt.Errorf("error creating zstd reader for %s: %v", redactURL(source), err)
 		}
-	case strings.HasSuffix(url, ".yaml"):
-		if err := yaml.Unmarshal(body.Bytes(), &repoIndex); err != nil {
-			return nil, fmt.Errorf("error decoding YAML from %s: %v", url, err)
+		defer zstdDecoder.Close()
+		if body, err = zstdDecoder.DecodeAll(body, nil); err != nil {
+			return nil, "", fmt.Errorf("error decompressing zstd data from %s: %v", redactURL(source), err)
+		}
+		return body, "zstd", nil
+	}
+	return body, "none", nil
+}
+
+// parseRepoIndex decodes an index, and tells which schema version it follows: the newest one any
+// of its entries carries, or 0 for legacy indexes
+func parseRepoIndex(source, format string, body []byte) ([]binaryEntry, int, error) {
+	var repoIndex map[string][]binaryEntry
+	switch format {
+	case "cbor":
+		if err := cbor.Unmarshal(body, &repoIndex); err != nil {
+			return nil, 0, fmt.Errorf("error decoding CBOR from %s: %v", redactURL(source), err)
+		}
+	case "json":
+		if err := json.Unmarshal(body, &repoIndex); err != nil {
+			return nil, 0, fmt.Errorf("error decoding JSON from %s: %v", redactURL(source), err)
+		}
+	case "yaml":
+		if err := yaml.Unmarshal(body, &repoIndex); err != nil {
+			return nil, 0, fmt.Errorf("error decoding YAML from %s: %v", redactURL(source), err)
 		}
 	default:
-		return nil, fmt.Errorf("unsupported format for URL: %s", url)
+		return nil, 0, fmt.Errorf("unsupported format for %s", redactURL(source))
 	}
 
+	repoNames := make([]string, 0, len(repoIndex))
+	for repoName := range repoIndex {
+		repoNames = append(repoNames, repoName)
+	}
+	sort.Strings(repoNames)
+
 	var binaryEntries []binaryEntry
-	for _, entries := range repoIndex {
-		binaryEntries = append(binaryEntries, entries...)
+	schemaVersion := 0
+	for _, repoName := range repoNames {
+		for _, entry := range repoIndex[repoName] {
+			entry.RepoName = repoName
+			schemaVersion = max(schemaVersion, int(entry.Schema))
+			binaryEntries = append(binaryEntries, entry)
+		}
+	}
+	if schemaVersion > repoIndexSchemaVersion {
+		return nil, schemaVersion, fmt.Errorf("%s uses index schema version %d, but this version of dbin only understands up to %d. Please update dbin", redactURL(source), schemaVersion, repoIndexSchemaVersion)
 	}
 
-	return binaryEntries, nil
+	return binaryEntries, schemaVersion, nil
+}
+
+// detectRepoIndexFormat tells the encoding of an already decompressed index. CBOR maps are
+// recognized by their initial byte, then the Content-Type and the file extension are consulted,
+// and text that is neither is assumed to be JSON when it looks like an object, YAML otherwise
+func detectRepoIndexFormat(source, contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if body[0]&0xe0 == 0xa0 || bytes.HasPrefix(body, cborSelfDescribeMagic) {
+		return "cbor"
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		switch {
+		case strings.HasSuffix(mediaType, "cbor"):
+			return "cbor"
+		case strings.HasSuffix(mediaType, "json"):
+			return "json"
+		case strings.HasSuffix(mediaType, "yaml"):
+			return "yaml"
+		}
+	}
+
+	source = strings.TrimSuffix(strings.TrimSuffix(source, ".gz"), ".zst")
+	switch filepath.Ext(source) {
+	case ".cbor":
+		return "cbor"
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("{")) {
+		return "json"
+	}
+	return "yaml"
 }
 
 func calculateChecksum(filePath string) (string, error) {
@@ -365,6 +609,38 @@ func calculateChecksum(filePath string) (string, error) {
 	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
 }
 
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	tempFile := dst + ".tmp"
+	out, err := os.OpenFile(tempFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		_ = os.Remove(tempFile)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(tempFile)
+		return err
+	}
+	if err := os.Rename(tempFile, dst); err != nil {
+		_ = os.Remove(tempFile)
+		return err
+	}
+	return nil
+}
+
 func isSymlink(filePath string) bool {
 	fileInfo, err := os.Lstat(filePath)
 	return err == nil && fileInfo.Mode()&os.ModeSymlink != 0
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// VariantPolicy decides which variant of a package is installed when several match. Patterns are
+// case-insensitive substrings of "name#pkg_id@repo", so "musl" matches a pkg_id, ".AppImage" a name
+// and "@bincache" a repository. Variants matching an Avoid pattern are only used when nothing else
+// matches, then the variant matching the earliest Prefer pattern wins, and then the highest Rank
+type VariantPolicy struct {
+	Prefer []string `yaml:"Prefer,omitempty"`
+	Avoid  []string `yaml:"Avoid,omitempty"`
+}
+
+var (
+	detectedLibc     string
+	detectedLibcOnce sync.Once
+)
+
+// hostLibc returns the C library binaries for the target architecture can be linked against:
+// "glibc", "musl" or "none". It is detected from the dynamic loaders present on the host unless
+// Libc is set, and is "" (unknown) when installing for another architecture
+func hostLibc(config *Config) string {
+	if config.Libc != "" && config.Libc != "auto" {
+		return config.Libc
+	}
+	if isCrossArch(config) {
+		return ""
+	}
+
+	detectedLibcOnce.Do(func() {
+		detectedLibc = "none"
+		for _, pattern := range []string{"/lib/ld-musl-*.so.1", "/usr/lib/ld-musl-*.so.1"} {
+			if matches, _ := filepath.Glob(pattern); len(matches) > 0 {
+				detectedLibc = "musl"
+			}
+		}
+		for _, pattern := range []string{"/lib*/ld-linux*.so.*", "/usr/lib*/ld-linux*.so.*", "/lib/*-linux-gnu*/libc.so.6"} {
+			if matches, _ := filepath.Glob(pattern); len(matches) > 0 {
+				detectedLibc = "glibc"
+			}
+		}
+	})
+	return detectedLibc
+}
+
+func isGlibcVariant(bin binaryEntry) bool {
+	return strings.Contains(strings.ToLower(bin.PkgId), "glibc")
+}
+
+// canRunVariant reports whether the libc of the system can run bin, when it is known
+func canRunVariant(config *Config, bin binaryEntry) bool {
+	libc := hostLibc(config)
+	return libc == "" || libc == "glibc" || !isGlibcVariant(bin)
+}
+
+func variantString(bin binaryEntry) string {
+	return parseBinaryEntry(bin, false) + ternary(bin.RepoName != "", "@"+bin.RepoName, "")
+}
+
+// variantPattern returns the position of the first pattern that bin matches, or -1
+func variantPattern(bin binaryEntry, patterns []string) int {
+	variant := strings.ToLower(variantString(bin))
+	for i, pattern := range patterns {
+		if pattern != "" && strings.Contains(variant, strings.ToLower(pattern)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// selectVariant picks one of the matching candidates according to the VariantPolicy, and
+// explains each step that narrowed them down. It returns an empty entry when none can be used
+func selectVariant(config *Config, matchingBins []binaryEntry) (binaryEntry, []string) {
+	var explanation []string
+	explain := func(format string, args ...interface{}) {
+		explanation = append(explanation, fmt.Sprintf(format, args...))
+	}
+
+	explain("%d candidate(s) left after the pkg_id, version and RepoPriorities filters", len(matchingBins))
+	if len(matchingBins) == 0 {
+		return binaryEntry{}, explanation
+	}
+	for _, bin := range matchingBins {
+		explain("  %s (version %s, rank %d)", variantString(bin), ternary(bin.Version != "", bin.Version, "unknown"), bin.Rank)
+	}
+
+	var runnable []binaryEntry
+	for _, bin := range matchingBins {
+		if !canRunVariant(config, bin) {
+			explain("excluded %s: glibc is not available (libc: %s)", variantString(bin), hostLibc(config))
+			continue
+		}
+		runnable = append(runnable, bin)
+	}
+	matchingBins = runnable
+	if len(matchingBins) == 0 {
+		explain("no candidate can run on this system")
+		return binaryEntry{}, explanation
+	}
+
+	var notAvoided []binaryEntry
+	for _, bin := range matchingBins {
+		if i := variantPattern(bin, config.VariantPolicy.Avoid); i >= 0 {
+			explain("avoided %s: matches Avoid pattern %q", variantString(bin), config.VariantPolicy.Avoid[i])
+			continue
+		}
+		notAvoided = append(notAvoided, bin)
+	}
+	if len(notAvoided) > 0 {
+		matchingBins = notAvoided
+	} else {
+		explain("every candidate is avoided, considering them anyway")
+	}
+
+	bestPreference := -1
+	for _, bin := range matchingBins {
+		if i := variantPattern(bin, config.VariantPolicy.Prefer); i >= 0 && (bestPreference < 0 || i < bestPreference) {
+			bestPreference = i
+		}
+	}
+	if bestPreference >= 0 {
+		var preferred []binaryEntry
+		for _, bin := range matchingBins {
+			if variantPattern(bin, config.VariantPolicy.Prefer) == bestPreference {
+				preferred = append(preferred, bin)
+			}
+		}
+		explain("preferred %d candidate(s) matching Prefer pattern %q", len(preferred), config.VariantPolicy.Prefer[bestPreference])
+		matchingBins = preferred
+	}
+
+	selectedBin := matchingBins[0]
+	for _, bin := range matchingBins[1:] {
+		if bin.Rank > selectedBin.Rank {
+			selectedBin = bin
+		}
+	}
+	if len(matchingBins) > 1 {
+		explain("picked %s, the one with the highest rank (%d)", variantString(selectedBin), selectedBin.Rank)
+	} else {
+		explain("picked %s", variantString(selectedBin))
+	}
+
+	return selectedBin, explanation
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/zeebo/blake3"
+)
+
+// What is done when a binary does not match its checksum, or has none: strict fails the install,
+// warn only tells, and off does not check binaries at all
+const (
+	verifyStrict = "strict"
+	verifyWarn   = "warn"
+	verifyOff    = "off"
+)
+
+// Checksums are passed around as the BLAKE3 of the binary in hex, as the index lists it, or as
+// "sha256:<hex>" when only its SHA-256 is known, which is also how OCI digests are written.
+// "!no_check" or "" mean that there is none
+const sha256ChecksumPrefix = "sha256:"
+
+func checkVerifyPolicy(config *Config) error {
+	switch config.VerifyPolicy {
+	case verifyStrict, verifyWarn, verifyOff:
+		return nil
+	case "":
+		config.VerifyPolicy = verifyStrict
+		return nil
+	}
+	return fmt.Errorf("invalid VerifyPolicy %q: it must be %s, %s or %s", config.VerifyPolicy, verifyStrict, verifyWarn, verifyOff)
+}
+
+// entryChecksum returns the checksum bEntry is to be verified against: its B3SUM, or its SHA256
+// when the index does not list one
+func entryChecksum(bEntry binaryEntry) string {
+	if bEntry.Bsum != "" {
+		return bEntry.Bsum
+	}
+	if bEntry.Shasum != "" {
+		return sha256ChecksumPrefix + bEntry.Shasum
+	}
+	return ""
+}
+
+func newChecksumHasher(checksum string) hash.Hash {
+	if strings.HasPrefix(checksum, sha256ChecksumPrefix) {
+		return sha256.New()
+	}
+	return blake3.New()
+}
+
+func checksumMatches(checksum string, hasher hash.Hash) bool {
+	return hex.EncodeToString(hasher.Sum(nil)) == strings.ToLower(strings.TrimPrefix(checksum, sha256ChecksumPrefix))
+}
+
+// fileMatchesChecksum reports whether the file at path has the given checksum
+func fileMatchesChecksum(path, checksum string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	hasher := newChecksumHasher(checksum)
+	if _, err := io.Copy(hasher, file); err != nil {
+		return false
+	}
+	return checksumMatches(checksum, hasher)
+}
+
+// verifyChecksum checks what hasher was fed, the contents of the binary name, against checksum
+// according to the VerifyPolicy. It only returns an error when the binary must not be installed
+func verifyChecksum(config *Config, name, checksum string, hasher hash.Hash) error {
+	if config.VerifyPolicy == verifyOff {
+		return nil
+	}
+	if !hasChecksum(checksum) {
+		if config.VerifyPolicy == verifyStrict {
+			return fmt.Errorf("no checksum exists for %s, so it cannot be verified. Pin one in its URL with #b3=<hex> or #sha256=<hex>, or set DBIN_VERIFY=warn to install it anyway", name)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: No checksum exists for %s, skipping verification.\n", name)
+		return nil
+	}
+	if checksumMatches(checksum, hasher) {
+		return nil
+	}
+
+	err := fmt.Errorf("checksum verification of %s failed: expected %s, got %s%s", name, checksum,
+		ternary(strings.HasPrefix(checksum, sha256ChecksumPrefix), sha256ChecksumPrefix, ""), hex.EncodeToString(hasher.Sum(nil)))
+	if config.VerifyPolicy == verifyWarn {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return nil
+	}
+	return err
+}
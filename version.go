@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Tokens that mark a pre-release, which sorts before the release it leads up to (1.7rc1 < 1.7)
+var preReleaseTokens = map[string]bool{
+	"alpha": true, "beta": true, "rc": true, "pre": true, "preview": true, "dev": true,
+}
+
+// versionTokens splits a version into runs of digits and runs of letters, dropping separators
+// and a leading "v", so that "v1.7.1", "1.7.1" and "1_7_1" are all [1 7 1]
+func versionTokens(version string) []string {
+	version = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(version)), "v")
+
+	var tokens []string
+	var current strings.Builder
+	lastDigit := false
+	for _, r := range version {
+		isDigit, isLetter := unicode.IsDigit(r), unicode.IsLetter(r)
+		if !isDigit && !isLetter || current.Len() > 0 && isDigit != lastDigit {
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		}
+		if isDigit || isLetter {
+			current.WriteRune(r)
+			lastDigit = isDigit
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
+
+// compareVersions orders versions leniently, in the spirit of semver: numeric parts are compared
+// as numbers, numbers sort after words, missing numeric parts count as 0 and a pre-release sorts
+// before its release.
+// It returns -1, 0 or 1 when a is older than, the same as or newer than b
+func compareVersions(a, b string) int {
+	aTokens, bTokens := versionTokens(a), versionTokens(b)
+	for i := 0; i < len(aTokens) || i < len(bTokens); i++ {
+		switch {
+		case i >= len(aTokens) && !isVersionNumber(bTokens[i]):
+			return ternary(preReleaseTokens[bTokens[i]], 1, -1)
+		case i >= len(bTokens) && !isVersionNumber(aTokens[i]):
+			return ternary(preReleaseTokens[aTokens[i]], -1, 1)
+		case i >= len(aTokens):
+			aTokens = append(aTokens, "0")
+		case i >= len(bTokens):
+			bTokens = append(bTokens, "0")
+		}
+
+		aNum, aErr := strconv.ParseUint(aTokens[i], 10, 64)
+		bNum, bErr := strconv.ParseUint(bTokens[i], 10, 64)
+		switch {
+		case aErr == nil && bErr == nil:
+			if aNum != bNum {
+				return ternary(aNum < bNum, -1, 1)
+			}
+		case aErr == nil:
+			return 1
+		case bErr == nil:
+			return -1
+		case aTokens[i] != bTokens[i]:
+			return ternary(aTokens[i] < bTokens[i], -1, 1)
+		}
+	}
+	return 0
+}
+
+func isVersionNumber(token string) bool {
+	return token != "" && unicode.IsDigit(rune(token[0]))
+}
+
+// versionConstraint is a parsed version specifier, as in "jq:>=1.7,<2". An empty constraint
+// or "latest" accepts every version
+type versionConstraint struct {
+	clauses []versionClause
+}
+
+type versionClause struct {
+	op      string
+	version string
+}
+
+func parseVersionConstraint(spec string) (versionConstraint, error) {
+	var constraint versionConstraint
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "latest" {
+		return constraint, nil
+	}
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		op := ""
+		for _, candidate := range []string{">=", "<=", "!=", "==", ">", "<", "=", "~", "^"} {
+			if strings.HasPrefix(part, candidate) {
+				op = candidate
+				break
+			}
+		}
+		version := strings.TrimSpace(strings.TrimPrefix(part, op))
+		if version == "" {
+			return constraint, fmt.Errorf("invalid version constraint %q", spec)
+		}
+
+		switch op {
+		case "~", "^":
+			// ~1.7 and ~1.7.3 allow anything below 1.8, ^1.7 anything below 2 (below 0.8 for ^0.7)
+			numbers := leadingVersionNumbers(version)
+			if len(numbers) == 0 {
+				return constraint, fmt.Errorf("invalid version constraint %q: %s needs a numeric version", spec, op)
+			}
+			keep := 1
+			if op == "~" && len(numbers) > 1 || op == "^" && numbers[0] == 0 && len(numbers) > 1 {
+				keep = 2
+			}
+			upper := append([]uint64{}, numbers[:keep]...)
+			upper[keep-1]++
+			upperParts := make([]string, len(upper))
+			for i, n := range upper {
+				upperParts[i] = strconv.FormatUint(n, 10)
+			}
+			// The pre-release marker keeps 1.8rc1 out of ~1.7
+			constraint.clauses = append(constraint.clauses,
+				versionClause{op: ">=", version: version},
+				versionClause{op: "<", version: strings.Join(upperParts, ".") + "alpha"},
+			)
+		case "", "==":
+			constraint.clauses = append(constraint.clauses, versionClause{op: "=", version: version})
+		default:
+			constraint.clauses = append(constraint.clauses, versionClause{op: op, version: version})
+		}
+	}
+	return constraint, nil
+}
+
+func leadingVersionNumbers(version string) []uint64 {
+	var numbers []uint64
+	for _, token := range versionTokens(version) {
+		n, err := strconv.ParseUint(token, 10, 64)
+		if err != nil {
+			break
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers
+}
+
+func (c versionConstraint) isRange() bool {
+	return len(c.clauses) != 1 || c.clauses[0].op != "="
+}
+
+func (c versionConstraint) matches(version string) bool {
+	for _, clause := range c.clauses {
+		cmp := compareVersions(version, clause.version)
+		var ok bool
+		switch clause.op {
+		case "=":
+			ok = cmp == 0 || version == clause.version
+		case "!=":
+			ok = cmp != 0
+		case ">=":
+			ok = cmp >= 0
+		case "<=":
+			ok = cmp <= 0
+		case ">":
+			ok = cmp > 0
+		case "<":
+			ok = cmp < 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// parseSnapshot splits a snapshot as listed in an index, "<tag>[<version>]", into its OCI tag and
+// the version it holds. Snapshots without a version in brackets hold the version named by their tag
+func parseSnapshot(snapshot string) (string, string) {
+	if i := strings.LastIndex(snapshot, "["); i > 0 && strings.HasSuffix(snapshot, "]") {
+		return snapshot[:i], snapshot[i+1 : len(snapshot)-1]
+	}
+	return snapshot, snapshot
+}
+
+// withOCITag returns the OCI reference ref pointing at tag instead of its own tag
+func withOCITag(ref, tag string) string {
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref = ref[:i]
+	}
+	return ref + ":" + tag
+}
@@ -0,0 +1,79 @@
+package main
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.7", "1.7", 0},
+		{"v1.7.1", "1.7.1", 0},
+		{"1_7_1", "1.7.1", 0},
+		{"1.7", "1.7.0", 0},
+		{"1.7.0.0", "1.7", 0},
+		{"1.7", "1.7.1", -1},
+		{"1.10", "1.9", 1},
+		{"1.7rc1", "1.7", -1},
+		{"1.7", "1.7rc1", 1},
+		{"1.7.0rc1", "1.7", -1},
+		{"1.7beta", "1.7rc1", -1},
+		{"1.7", "1.7a", -1},
+		{"1.7.1", "1.7a", 1},
+		{"2024.01.02", "2023.12.31", 1},
+	}
+	for _, test := range tests {
+		if got := compareVersions(test.a, test.b); got != test.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestParseVersionConstraint(t *testing.T) {
+	tests := []struct {
+		spec     string
+		version  string
+		want     bool
+		isRange  bool
+		wantsErr bool
+	}{
+		{spec: "", version: "1.7", want: true, isRange: true},
+		{spec: "latest", version: "0.1", want: true, isRange: true},
+		{spec: "1.7", version: "1.7", want: true},
+		{spec: "1.7.0", version: "1.7", want: true},
+		{spec: "==1.7", version: "1.7.0", want: true},
+		{spec: "1.7", version: "1.7.1", want: false},
+		{spec: ">=1.7.0", version: "1.7", want: true, isRange: true},
+		{spec: ">=1.7", version: "1.6.9", want: false, isRange: true},
+		{spec: ">=1.7,<2", version: "1.9", want: true, isRange: true},
+		{spec: ">=1.7,<2", version: "2.0", want: false, isRange: true},
+		{spec: "!=1.7", version: "1.7.0", want: false, isRange: true},
+		{spec: "~1.7", version: "1.7.9", want: true, isRange: true},
+		{spec: "~1.7", version: "1.8rc1", want: false, isRange: true},
+		{spec: "~1.7.3", version: "1.7.2", want: false, isRange: true},
+		{spec: "^1.7", version: "1.99", want: true, isRange: true},
+		{spec: "^1.7", version: "2.0", want: false, isRange: true},
+		{spec: "^0.7", version: "0.8", want: false, isRange: true},
+		{spec: ">=", wantsErr: true},
+		{spec: "~beta", wantsErr: true},
+	}
+	for _, test := range tests {
+		constraint, err := parseVersionConstraint(test.spec)
+		if test.wantsErr {
+			if err == nil {
+				t.Errorf("parseVersionConstraint(%q) did not fail", test.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseVersionConstraint(%q) failed: %v", test.spec, err)
+			continue
+		}
+		if got := constraint.matches(test.version); got != test.want {
+			t.Errorf("%q matches %q = %v, want %v", test.spec, test.version, got, test.want)
+		}
+		if got := constraint.isRange(); got != test.isRange {
+			t.Errorf("%q isRange = %v, want %v", test.spec, got, test.isRange)
+		}
+	}
+}